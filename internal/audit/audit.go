@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/jsonl"
+	"github.com/alexraskin/swarmctl/internal/middle"
+)
+
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	Token     string    `json:"token"`
+	ClientIP  string    `json:"clientIp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Service   string    `json:"service,omitempty"`
+	OldImage  string    `json:"oldImage,omitempty"`
+	NewImage  string    `json:"newImage,omitempty"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+	Duration  float64   `json:"durationSeconds"`
+}
+
+type Filter struct {
+	Service string
+	Since   time.Time
+	Limit   int
+}
+
+// Log is an append-only JSON lines file of audit entries.
+type Log struct {
+	file *jsonl.File[Entry]
+}
+
+func Open(path string) (*Log, error) {
+	file, err := jsonl.Open[Entry](path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{file: file}, nil
+}
+
+func (l *Log) Append(e Entry) error {
+	return l.file.Append(e)
+}
+
+// Query returns matching entries, newest first.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	return l.file.Read(func(e Entry) bool {
+		return (filter.Service == "" || e.Service == filter.Service) && !e.Time.Before(filter.Since)
+	}, filter.Limit)
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+type entryContextKey struct{}
+
+// FromContext returns the entry being recorded for the request, so handlers can add the
+// service and images they touched. It returns nil for requests that are not audited.
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryContextKey{}).(*Entry)
+	return e
+}
+
+// Middleware records every mutating request. It must run after RequestID and RealIP,
+// and before the auth middleware so requests that fail authentication are recorded too.
+// Identify then names the token once it is known.
+func Middleware(log *Log, onError func(error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			entry := &Entry{
+				Time:      start,
+				RequestID: middleware.GetReqID(r.Context()),
+				Token:     middle.TokenName(r.Context()),
+				ClientIP:  r.RemoteAddr,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), entryContextKey{}, entry)))
+
+			entry.Status = ww.Status()
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			entry.Outcome = outcome(entry.Status)
+			entry.Duration = time.Since(start).Seconds()
+
+			if err := log.Append(*entry); err != nil {
+				onError(err)
+			}
+		})
+	}
+}
+
+// Identify names the authenticated token on the request's audit entry. It must run
+// after the auth middleware.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry := FromContext(r.Context()); entry != nil {
+			entry.Token = middle.TokenName(r.Context())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func outcome(status int) string {
+	switch {
+	case status < 300:
+		return "success"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	case status < 500:
+		return "rejected"
+	}
+	return "error"
+}
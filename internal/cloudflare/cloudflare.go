@@ -3,7 +3,10 @@ package cloudflare
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/cloudflare/cloudflare-go/v4"
 	"github.com/cloudflare/cloudflare-go/v4/dns"
@@ -14,6 +17,7 @@ import (
 )
 
 type CloudflareClient struct {
+	mu                  sync.Mutex // serializes read-modify-write of the tunnel config
 	client              *cloudflare.Client
 	cloudflareTunnelID  string
 	cloudflareAccountID string
@@ -31,44 +35,47 @@ func NewCloudflareClient(apiKey string, apiEmail string, cloudflareTunnelID stri
 	}, nil
 }
 
-func (c *CloudflareClient) UpdateTunnelConfig(ctx context.Context, hostname, serviceURL string) error {
+// ApplyIngress sets every rule in desired, removing rules with an empty Service, and
+// writes the resulting ingress list, ordered most-specific-first, in a single update.
+// Calls are serialized so concurrent syncs can't overwrite each other's changes.
+func (c *CloudflareClient) ApplyIngress(ctx context.Context, desired map[IngressKey]Ingress) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	existingConfig, err := c.GetTunnelConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get existing tunnel config: %w", err)
 	}
 
-	ingressList := []zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress{}
+	rules := make(map[IngressKey]zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress)
 
-	// If serviceURL is not empty, add/update the hostname at the beginning
-	if serviceURL != "" {
-		ingressList = append(ingressList, zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress{
-			Hostname: cloudflare.F(hostname),
-			Service:  cloudflare.F(serviceURL),
-		})
-	}
-
-	// Add all existing entries except:
+	// Keep all existing entries except:
 	// - The 404 catch-all (we'll add it at the end)
-	// - The hostname we're updating/removing
 	// - Comma-separated hostnames
 	for _, ingress := range existingConfig.Config.Ingress {
 		if ingress.Service == "http_status:404" {
 			continue
 		}
 
-		if ingress.Hostname == hostname {
+		if strings.Contains(ingress.Hostname, ",") {
 			continue
 		}
 
-		if strings.Contains(ingress.Hostname, ",") {
+		rules[IngressKey{Hostname: ingress.Hostname, Path: ingress.Path}] = keepExisting(ingress)
+	}
+
+	for key, rule := range desired {
+		if rule.Service == "" {
+			delete(rules, key)
 			continue
 		}
+		rules[key] = rule.params()
+	}
 
-		ingressList = append(ingressList, zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress{
-			Hostname: cloudflare.F(ingress.Hostname),
-			Service:  cloudflare.F(ingress.Service),
-		})
+	keys := slices.SortedFunc(maps.Keys(rules), compareSpecificity)
+	ingressList := make([]zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress, 0, len(keys)+1)
+	for _, key := range keys {
+		ingressList = append(ingressList, rules[key])
 	}
 
 	// Always add the 404 catch-all at the end
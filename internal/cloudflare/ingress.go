@@ -0,0 +1,360 @@
+package cloudflare
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+const labelPrefix = "cloudflared.tunnel."
+
+// schemes are the origin protocols a service can be exposed with.
+var schemes = []string{"http", "https", "tcp", "ssh", "rdp", "unix"}
+
+// Ingress is one rule of the tunnel, routing a hostname, optionally narrowed to paths
+// matching the Path regex, to an origin. An empty Service removes the rule.
+type Ingress struct {
+	Hostname      string
+	Path          string
+	Service       string
+	OriginRequest OriginRequest
+}
+
+// IngressKey identifies a rule. Several rules may share a hostname with different paths.
+type IngressKey struct {
+	Hostname string
+	Path     string
+}
+
+func (i Ingress) Key() IngressKey {
+	return IngressKey{Hostname: i.Hostname, Path: i.Path}
+}
+
+func (k IngressKey) String() string {
+	return k.Hostname + k.Path
+}
+
+// compareSpecificity orders rules most-specific-first, the order cloudflared needs since
+// it routes each request to the first matching rule: exact hostnames before wildcards,
+// and for each hostname, longer paths before shorter ones and the path-less rule last.
+func compareSpecificity(a, b IngressKey) int {
+	aWildcard, bWildcard := strings.HasPrefix(a.Hostname, "*"), strings.HasPrefix(b.Hostname, "*")
+	switch {
+	case aWildcard != bWildcard:
+		if aWildcard {
+			return 1
+		}
+		return -1
+	case aWildcard && len(a.Hostname) != len(b.Hostname):
+		return len(b.Hostname) - len(a.Hostname)
+	case a.Hostname != b.Hostname:
+		return strings.Compare(a.Hostname, b.Hostname)
+	case (a.Path == "") != (b.Path == ""):
+		if a.Path == "" {
+			return 1
+		}
+		return -1
+	case len(a.Path) != len(b.Path):
+		return len(b.Path) - len(a.Path)
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// OriginRequest holds the per-hostname settings for the connection from cloudflared to
+// the origin that can be set with labels.
+type OriginRequest struct {
+	NoTLSVerify            bool
+	HTTPHostHeader         string
+	OriginServerName       string
+	ConnectTimeout         int64 // seconds
+	HTTP2Origin            bool
+	DisableChunkedEncoding bool
+}
+
+// hostnameGroup is a hostname label with the settings labels that share its prefix, e.g.
+// cloudflared.tunnel.0.hostname with cloudflared.tunnel.0.port and cloudflared.tunnel.0.path.
+type hostnameGroup struct {
+	key       string
+	prefix    string
+	hostnames []string
+}
+
+// hostnameGroups returns every hostname label of a service, the primary
+// cloudflared.tunnel.hostname first and the rest ordered by label.
+func hostnameGroups(labels map[string]string) []hostnameGroup {
+	groups := []hostnameGroup{}
+	for key, value := range labels {
+		if !strings.HasSuffix(key, ".hostname") || value == "" {
+			continue
+		}
+
+		group := hostnameGroup{key: key, prefix: strings.TrimSuffix(key, "hostname")}
+		for h := range strings.SplitSeq(value, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				group.hostnames = append(group.hostnames, h)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	slices.SortFunc(groups, func(a, b hostnameGroup) int {
+		if (a.prefix == labelPrefix) != (b.prefix == labelPrefix) {
+			if a.prefix == labelPrefix {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	return groups
+}
+
+// label returns a setting for the group's hostnames, falling back to the service-wide
+// cloudflared.tunnel.<name> label.
+func (g hostnameGroup) label(labels map[string]string, name string) string {
+	if v := labels[g.prefix+name]; v != "" {
+		return v
+	}
+	return labels[labelPrefix+name]
+}
+
+// address returns the port and target for the group's hostnames. They are inherited
+// from the service-wide labels only as a pair and only when the group sets neither, so a
+// group's own port is never overridden by a service-wide target.
+func (g hostnameGroup) address(labels map[string]string) (port, target string) {
+	port, target = labels[g.prefix+"port"], labels[g.prefix+"target"]
+	if port == "" && target == "" {
+		port, target = labels[labelPrefix+"port"], labels[labelPrefix+"target"]
+	}
+	return port, target
+}
+
+// Hostnames returns every hostname a service's labels ask the tunnel to route.
+func Hostnames(labels map[string]string) []string {
+	hostnames := []string{}
+	for _, group := range hostnameGroups(labels) {
+		hostnames = append(hostnames, group.hostnames...)
+	}
+	return hostnames
+}
+
+// ServiceIngress returns the ingress rules a tunnel-enabled service asks for, most
+// specific first. Settings can be given for the whole service, e.g.
+// cloudflared.tunnel.port, or next to an indexed hostname, e.g. cloudflared.tunnel.0.port,
+// which takes precedence for that hostname. This lets one service expose several ports
+// or protocols under different hostnames. See hostnameGroup.address for how a port and
+// target are inherited.
+func ServiceIngress(svc *swarm.Service) ([]Ingress, error) {
+	labels := svc.Spec.Labels
+
+	rules := []Ingress{}
+	for _, group := range hostnameGroups(labels) {
+		label := func(name string) string { return group.label(labels, name) }
+
+		port, address := group.address(labels)
+		target, err := serviceTarget(svc.Spec.Name, label("scheme"), port, address)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", group.key, err)
+		}
+
+		origin, err := parseOriginRequest(label)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", group.key, err)
+		}
+
+		// cloudflared matches paths as Go regular expressions
+		path := label("path")
+		if _, err := regexp.Compile(path); err != nil {
+			return nil, fmt.Errorf("%s: invalid path %q: %w", group.key, path, err)
+		}
+
+		for _, h := range group.hostnames {
+			rules = append(rules, Ingress{Hostname: h, Path: path, Service: target, OriginRequest: origin})
+		}
+	}
+
+	slices.SortFunc(rules, func(a, b Ingress) int { return compareSpecificity(a.Key(), b.Key()) })
+	return rules, nil
+}
+
+// serviceTarget builds the origin URL cloudflared connects to. By default that is the
+// service's name and port, which target can replace with another address, such as
+// "10.0.0.5:22", or the socket path for unix origins.
+func serviceTarget(name, scheme, port, target string) (string, error) {
+	if scheme == "" {
+		scheme = "http"
+	}
+	scheme = strings.ToLower(scheme)
+	if !slices.Contains(schemes, scheme) {
+		return "", fmt.Errorf("unsupported scheme %q, must be one of %s", scheme, strings.Join(schemes, ", "))
+	}
+
+	if scheme == "unix" {
+		if target == "" {
+			return "", fmt.Errorf("unix origins need a socket path in %starget", labelPrefix)
+		}
+		return normalizeService("unix:" + target), nil
+	}
+
+	if target == "" {
+		if port == "" {
+			return "", fmt.Errorf("%sport or %starget must be set", labelPrefix, labelPrefix)
+		}
+		target = name + ":" + port
+	}
+	return normalizeService(scheme + "://" + target), nil
+}
+
+// normalizeService puts an origin URL in one canonical form, so a rule read back from
+// the tunnel compares equal to the one generated from labels.
+func normalizeService(service string) string {
+	scheme, rest, ok := strings.Cut(service, ":")
+	if !ok || strings.HasPrefix(service, "http_status:") {
+		return service
+	}
+	return strings.ToLower(scheme) + ":" + strings.TrimSuffix(rest, "/")
+}
+
+func parseOriginRequest(label func(name string) string) (OriginRequest, error) {
+	var origin OriginRequest
+	var err error
+
+	bools := []struct {
+		name  string
+		value *bool
+	}{
+		{"noTLSVerify", &origin.NoTLSVerify},
+		{"http2Origin", &origin.HTTP2Origin},
+		{"disableChunkedEncoding", &origin.DisableChunkedEncoding},
+	}
+	for _, b := range bools {
+		if raw := label(b.name); raw != "" {
+			if *b.value, err = strconv.ParseBool(raw); err != nil {
+				return OriginRequest{}, fmt.Errorf("invalid %s value %q", b.name, raw)
+			}
+		}
+	}
+
+	origin.HTTPHostHeader = label("httpHostHeader")
+	origin.OriginServerName = label("originServerName")
+
+	if raw := label("connectTimeout"); raw != "" {
+		// Accept a duration such as "30s", or plain seconds as cloudflared does
+		timeout, err := time.ParseDuration(raw)
+		if err != nil {
+			seconds, convErr := strconv.ParseInt(raw, 10, 64)
+			if convErr != nil {
+				return OriginRequest{}, fmt.Errorf("invalid connectTimeout value %q", raw)
+			}
+			timeout = time.Duration(seconds) * time.Second
+		}
+		if timeout < 0 {
+			return OriginRequest{}, fmt.Errorf("invalid connectTimeout value %q", raw)
+		}
+		origin.ConnectTimeout = int64(timeout / time.Second)
+	}
+
+	return origin, nil
+}
+
+// fromExisting converts an ingress rule read from the tunnel for comparison with the
+// rules services ask for.
+func fromExisting(ingress zero_trust.TunnelCloudflaredConfigurationGetResponseConfigIngress) Ingress {
+	o := ingress.OriginRequest
+	return Ingress{
+		Hostname: ingress.Hostname,
+		Path:     ingress.Path,
+		Service:  normalizeService(ingress.Service),
+		OriginRequest: OriginRequest{
+			NoTLSVerify:            o.NoTLSVerify,
+			HTTPHostHeader:         o.HTTPHostHeader,
+			OriginServerName:       o.OriginServerName,
+			ConnectTimeout:         o.ConnectTimeout,
+			HTTP2Origin:            o.HTTP2Origin,
+			DisableChunkedEncoding: o.DisableChunkedEncoding,
+		},
+	}
+}
+
+// params builds the rule sent to Cloudflare. Only settings that differ from cloudflared's
+// defaults are included.
+func (i Ingress) params() zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress {
+	origin := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}
+	o := i.OriginRequest
+	if o.NoTLSVerify {
+		origin.NoTLSVerify = cloudflare.F(true)
+	}
+	if o.HTTPHostHeader != "" {
+		origin.HTTPHostHeader = cloudflare.F(o.HTTPHostHeader)
+	}
+	if o.OriginServerName != "" {
+		origin.OriginServerName = cloudflare.F(o.OriginServerName)
+	}
+	if o.ConnectTimeout > 0 {
+		origin.ConnectTimeout = cloudflare.F(o.ConnectTimeout)
+	}
+	if o.HTTP2Origin {
+		origin.HTTP2Origin = cloudflare.F(true)
+	}
+	if o.DisableChunkedEncoding {
+		origin.DisableChunkedEncoding = cloudflare.F(true)
+	}
+
+	rule := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress{
+		Hostname:      cloudflare.F(i.Hostname),
+		Service:       cloudflare.F(i.Service),
+		OriginRequest: cloudflare.F(origin),
+	}
+	if i.Path != "" {
+		rule.Path = cloudflare.F(i.Path)
+	}
+	return rule
+}
+
+// keepExisting rewrites a rule swarmctl doesn't manage as it was, including origin
+// settings it has no labels for, so rules added by hand survive a sync.
+func keepExisting(ingress zero_trust.TunnelCloudflaredConfigurationGetResponseConfigIngress) zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress {
+	rule := fromExisting(ingress).params()
+	rule.Service = cloudflare.F(ingress.Service)
+	o := ingress.OriginRequest
+	origin := rule.OriginRequest.Value
+
+	if o.CAPool != "" {
+		origin.CAPool = cloudflare.F(o.CAPool)
+	}
+	if o.KeepAliveConnections > 0 {
+		origin.KeepAliveConnections = cloudflare.F(o.KeepAliveConnections)
+	}
+	if o.KeepAliveTimeout > 0 {
+		origin.KeepAliveTimeout = cloudflare.F(o.KeepAliveTimeout)
+	}
+	if o.NoHappyEyeballs {
+		origin.NoHappyEyeballs = cloudflare.F(true)
+	}
+	if o.ProxyType != "" {
+		origin.ProxyType = cloudflare.F(o.ProxyType)
+	}
+	if o.TCPKeepAlive > 0 {
+		origin.TCPKeepAlive = cloudflare.F(o.TCPKeepAlive)
+	}
+	if o.TLSTimeout > 0 {
+		origin.TLSTimeout = cloudflare.F(o.TLSTimeout)
+	}
+	if len(o.Access.AUDTag) > 0 {
+		origin.Access = cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequestAccess{
+			AUDTag:   cloudflare.F(o.Access.AUDTag),
+			TeamName: cloudflare.F(o.Access.TeamName),
+			Required: cloudflare.F(o.Access.Required),
+		})
+	}
+
+	rule.OriginRequest = cloudflare.F(origin)
+	return rule
+}
@@ -0,0 +1,81 @@
+package cloudflare
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func TestServiceIngressGroupPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string // hostname -> service
+	}{
+		{
+			name: "group port beats service-wide target",
+			labels: map[string]string{
+				"cloudflared.tunnel.target":     "10.0.0.5:22",
+				"cloudflared.tunnel.scheme":     "ssh",
+				"cloudflared.tunnel.hostname":   "ssh.example.com",
+				"cloudflared.tunnel.0.hostname": "app.example.com",
+				"cloudflared.tunnel.0.port":     "8080",
+				"cloudflared.tunnel.0.scheme":   "http",
+			},
+			want: map[string]string{
+				"ssh.example.com": "ssh://10.0.0.5:22",
+				"app.example.com": "http://web:8080",
+			},
+		},
+		{
+			name: "group target beats service-wide port",
+			labels: map[string]string{
+				"cloudflared.tunnel.port":       "80",
+				"cloudflared.tunnel.0.hostname": "app.example.com",
+				"cloudflared.tunnel.1.hostname": "db.example.com",
+				"cloudflared.tunnel.1.target":   "db:5432",
+				"cloudflared.tunnel.1.scheme":   "tcp",
+			},
+			want: map[string]string{
+				"app.example.com": "http://web:80",
+				"db.example.com":  "tcp://db:5432",
+			},
+		},
+		{
+			name: "scheme is inherited on its own",
+			labels: map[string]string{
+				"cloudflared.tunnel.scheme":     "https",
+				"cloudflared.tunnel.target":     "backend:8443",
+				"cloudflared.tunnel.0.hostname": "app.example.com",
+				"cloudflared.tunnel.0.port":     "9443",
+			},
+			want: map[string]string{
+				"app.example.com": "https://web:9443",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &swarm.Service{}
+			svc.Spec.Name = "web"
+			svc.Spec.Labels = tt.labels
+
+			rules, err := ServiceIngress(svc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, rule := range rules {
+				got[rule.Hostname] = rule.Service
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got rules %v, want %v", got, tt.want)
+			}
+			for hostname, service := range tt.want {
+				if got[hostname] != service {
+					t.Errorf("%s: got service %q, want %q", hostname, got[hostname], service)
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package cloudflare
 import (
 	"context"
 	"fmt"
-	"strings"
+	"slices"
 	"sync"
 
 	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
@@ -12,37 +12,33 @@ import (
 
 type API interface {
 	GetTunnelConfig(ctx context.Context) (*zero_trust.TunnelCloudflaredConfigurationGetResponse, error)
-	UpdateTunnelConfig(ctx context.Context, hostname, targetURL string) error
+	ApplyIngress(ctx context.Context, desired map[IngressKey]Ingress) error
 	GetZoneID(ctx context.Context, hostname string) (string, error)
 	CreateTunnelDNSRecord(ctx context.Context, zoneID, hostname string) error
 	DeleteTunnelDNSRecord(ctx context.Context, recordID string, zoneID string) error
 	GetTunnelDNSRecord(ctx context.Context, zoneID string, hostname string) (string, error)
 }
 
-type existingConfig struct {
-	ID  string
-	URL string
-}
-
 type Syncer struct {
 	client API
 	mu     sync.Mutex
-	cache  map[string]existingConfig
+	cache  map[IngressKey]Ingress
 }
 
 func NewSyncer(client API) *Syncer {
 	return &Syncer{client: client}
 }
 
-func (s *Syncer) LoadExisting(ctx context.Context) (map[string]existingConfig, error) {
+func (s *Syncer) LoadExisting(ctx context.Context) (map[IngressKey]Ingress, error) {
 	resp, err := s.client.GetTunnelConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	cache := make(map[string]existingConfig)
+	cache := make(map[IngressKey]Ingress)
 	for _, entry := range resp.Config.Ingress {
-		cache[entry.Hostname] = existingConfig{ID: entry.Hostname, URL: entry.Service}
+		rule := fromExisting(entry)
+		cache[rule.Key()] = rule
 	}
 	return cache, nil
 }
@@ -50,61 +46,113 @@ func (s *Syncer) LoadExisting(ctx context.Context) (map[string]existingConfig, e
 func (s *Syncer) SyncService(ctx context.Context, svc *swarm.Service) error {
 	s.mu.Lock()
 	if s.cache == nil {
-		s.cache = make(map[string]existingConfig)
-		rep, err := s.client.GetTunnelConfig(ctx)
+		cache, err := s.LoadExisting(ctx)
 		if err != nil {
 			s.mu.Unlock()
 			return fmt.Errorf("initial load: %w", err)
 		}
-		for _, e := range rep.Config.Ingress {
-			s.cache[e.Hostname] = existingConfig{ID: e.Hostname, URL: e.Service}
-		}
+		s.cache = cache
 	}
 	s.mu.Unlock()
 
-	labels := svc.Spec.Labels
-	target := fmt.Sprintf("http://%s:%s", svc.Spec.Name, labels["cloudflared.tunnel.port"])
+	rules, err := ServiceIngress(svc)
+	if err != nil {
+		return err
+	}
 
-	hosts := []string{}
+	wanted := make(map[IngressKey]Ingress, len(rules))
+	hostnames := make(map[string]bool)
+	services := make(map[string]bool)
+	for _, rule := range rules {
+		wanted[rule.Key()] = rule
+		hostnames[rule.Hostname] = true
+		services[rule.Service] = true
+	}
 
-	// Collect all hostname labels
-	if primary := labels["cloudflared.tunnel.hostname"]; primary != "" {
-		hosts = append(hosts, primary)
+	// Work out which rules need changing, so the tunnel is written once per service
+	desired := make(map[IngressKey]Ingress)
+	added := []string{}
+	s.mu.Lock()
+	for key, rule := range wanted {
+		if ex, ok := s.cache[key]; !ok || ex != rule {
+			desired[key] = rule
+		}
+		if !s.hasHostname(rule.Hostname) && !slices.Contains(added, rule.Hostname) {
+			added = append(added, rule.Hostname)
+		}
 	}
-	for k, v := range labels {
-		if k != "cloudflared.tunnel.hostname" && strings.HasSuffix(k, ".hostname") && v != "" {
-			hosts = append(hosts, v)
+	// Drop rules this service used to have on its hostnames, e.g. after a path change.
+	// Rules of other services sharing a hostname point elsewhere and are left alone.
+	for key, ex := range s.cache {
+		if _, ok := wanted[key]; !ok && hostnames[key.Hostname] && services[ex.Service] {
+			desired[key] = Ingress{Hostname: key.Hostname, Path: key.Path}
 		}
 	}
+	s.mu.Unlock()
 
-	for _, list := range hosts {
-		for h0 := range strings.SplitSeq(list, ",") {
-			h := strings.TrimSpace(h0)
-			if h == "" {
-				continue
-			}
+	if len(desired) > 0 {
+		if err := s.client.ApplyIngress(ctx, desired); err != nil {
+			return fmt.Errorf("update ingress: %w", err)
+		}
+	}
 
-			ex, ok := s.cache[h]
-			if !ok || ex.URL != target {
-				if err := s.client.UpdateTunnelConfig(ctx, h, target); err != nil {
-					return fmt.Errorf("update %s: %w", h, err)
-				}
-			}
+	s.mu.Lock()
+	for key, rule := range desired {
+		switch {
+		case rule.Service == "":
+			delete(s.cache, key)
+		case !slices.Contains(added, key.Hostname):
+			s.cache[key] = rule
+		}
+	}
+	s.mu.Unlock()
 
-			if !ok {
-				zoneID, err := s.client.GetZoneID(ctx, h)
-				if err != nil {
-					return fmt.Errorf("zone %s: %w", h, err)
-				}
-				if err := s.client.CreateTunnelDNSRecord(ctx, zoneID, h); err != nil {
-					return fmt.Errorf("dns %s: %w", h, err)
-				}
-			}
+	// New hostnames are only cached once their DNS record exists, so a failure is retried
+	for _, h := range added {
+		zoneID, err := s.client.GetZoneID(ctx, h)
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", h, err)
+		}
+		if err := s.client.CreateTunnelDNSRecord(ctx, zoneID, h); err != nil {
+			return fmt.Errorf("dns %s: %w", h, err)
+		}
 
-			s.mu.Lock()
-			s.cache[h] = existingConfig{ID: h, URL: target}
-			s.mu.Unlock()
+		s.mu.Lock()
+		for key, rule := range wanted {
+			if key.Hostname == h {
+				s.cache[key] = rule
+			}
 		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// RemoveRules deletes the rules at keys from the tunnel in a single update and forgets
+// them, so a later sync of their hostnames writes them again.
+func (s *Syncer) RemoveRules(ctx context.Context, keys []IngressKey) error {
+	removals := make(map[IngressKey]Ingress, len(keys))
+	for _, key := range keys {
+		removals[key] = Ingress{Hostname: key.Hostname, Path: key.Path}
 	}
+	if err := s.client.ApplyIngress(ctx, removals); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, key := range keys {
+		delete(s.cache, key)
+	}
+	s.mu.Unlock()
 	return nil
 }
+
+// hasHostname reports whether any cached rule routes hostname. Callers hold s.mu.
+func (s *Syncer) hasHostname(hostname string) bool {
+	for key := range s.cache {
+		if key.Hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
@@ -3,72 +3,384 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/alexraskin/swarmctl/internal/registry"
 )
 
 type DockerClient struct {
-	dockerClient *client.Client
+	dockerClient  *client.Client
+	registryAuths registry.Auths
 }
 
-func NewDockerClient() (*DockerClient, error) {
+func NewDockerClient(registryAuths registry.Auths) (*DockerClient, error) {
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %v", err)
 	}
+
 	return &DockerClient{
-		dockerClient: dockerClient,
+		dockerClient:  dockerClient,
+		registryAuths: registryAuths,
 	}, nil
 }
 
 type DockerUpdateResponse struct {
-	Success    bool   `json:"success"`
-	OldVersion uint64 `json:"oldVersion"`
-	NewVersion uint64 `json:"newVersion"`
+	Success    bool           `json:"success"`
+	OldVersion uint64         `json:"oldVersion"`
+	NewVersion uint64         `json:"newVersion"`
+	Image      string         `json:"image,omitempty"`
+	OldDigest  string         `json:"oldDigest,omitempty"`
+	NewDigest  string         `json:"newDigest,omitempty"`
+	Warnings   []string       `json:"warnings,omitempty"`
+	Rollout    *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RolloutStatus describes where a service update ended up after waiting for it to converge.
+type RolloutStatus struct {
+	State      string      `json:"state"`
+	Message    string      `json:"message,omitempty"`
+	Elapsed    string      `json:"elapsed"`
+	TaskErrors []TaskError `json:"taskErrors,omitempty"`
 }
 
+type TaskError struct {
+	TaskID   string `json:"taskId"`
+	NodeID   string `json:"nodeId"`
+	State    string `json:"state"`
+	Error    string `json:"error"`
+	ExitCode int    `json:"exitCode"`
+}
+
+const (
+	RolloutStateTimeout     = "timeout"
+	convergencePollInterval = 2 * time.Second
+)
+
 func (d *DockerClient) GetDockerService(serviceName string, ctx context.Context) (*swarm.Service, error) {
 	service, _, err := d.dockerClient.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get service: %v", err)
+		return nil, fmt.Errorf("failed to get service: %w", err)
 	}
 	return &service, nil
 }
 
 func (d *DockerClient) UpdateDockerService(serviceName string, image string, ctx context.Context) (*DockerUpdateResponse, error) {
+	return d.ApplyDockerServiceUpdate(serviceName, ServiceUpdateSpec{Image: image}, ctx)
+}
+
+// ApplyDockerServiceUpdate applies update onto the service's current spec and submits it.
+func (d *DockerClient) ApplyDockerServiceUpdate(serviceName string, update ServiceUpdateSpec, ctx context.Context) (*DockerUpdateResponse, error) {
 
 	service, err := d.GetDockerService(serviceName, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service: %v", err)
 	}
 
+	if err := update.apply(&service.Spec); err != nil {
+		return nil, err
+	}
+
 	oldVersion := service.Version.Index
+	oldDigest := ImageDigest(service.Spec.TaskTemplate.ContainerSpec.Image)
+	newDigest := oldDigest
+	warnings := []string{}
 
-	service.Spec.TaskTemplate.ContainerSpec.Image = image
+	if update.Image != "" {
+		// Pin the tag to its digest so every node runs the same image. Like the docker CLI,
+		// fall back to the plain tag if the registry cannot be reached.
+		pinned, digest, err := d.ResolveImageDigest(update.Image, ctx)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("image %s could not be accessed on a registry to record its digest: %v", update.Image, err))
+			pinned = update.Image
+		}
+		service.Spec.TaskTemplate.ContainerSpec.Image = pinned
+		newDigest = digest
+	}
 
-	_, err = d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, types.ServiceUpdateOptions{})
+	encodedAuth, err := d.encodedRegistryAuth(service.Spec.TaskTemplate.ContainerSpec.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, types.ServiceUpdateOptions{
+		EncodedRegistryAuth: encodedAuth,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to update service: %v", err)
 	}
+	warnings = append(warnings, resp.Warnings...)
+
+	return &DockerUpdateResponse{
+		Success:    true,
+		OldVersion: oldVersion,
+		NewVersion: d.currentVersion(service, ctx),
+		Image:      service.Spec.TaskTemplate.ContainerSpec.Image,
+		OldDigest:  oldDigest,
+		NewDigest:  newDigest,
+		Warnings:   warnings,
+	}, nil
+}
+
+func (d *DockerClient) RollbackDockerService(serviceName string, ctx context.Context) (*DockerUpdateResponse, error) {
+
+	service, err := d.GetDockerService(serviceName, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %v", err)
+	}
+
+	if service.PreviousSpec == nil {
+		return nil, fmt.Errorf("service %s has no previous spec to roll back to", serviceName)
+	}
+
+	oldVersion := service.Version.Index
+
+	encodedAuth, err := d.encodedRegistryAuth(service.PreviousSpec.TaskTemplate.ContainerSpec.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, types.ServiceUpdateOptions{
+		EncodedRegistryAuth: encodedAuth,
+		Rollback:            "previous",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rollback service: %v", err)
+	}
 	return &DockerUpdateResponse{
 		Success:    true,
 		OldVersion: oldVersion,
-		NewVersion: service.Version.Index,
+		NewVersion: d.currentVersion(service, ctx),
+		Image:      service.PreviousSpec.TaskTemplate.ContainerSpec.Image,
+		OldDigest:  ImageDigest(service.Spec.TaskTemplate.ContainerSpec.Image),
+		NewDigest:  ImageDigest(service.PreviousSpec.TaskTemplate.ContainerSpec.Image),
 	}, nil
 }
 
+// currentVersion re-reads the service's version after an update, falling back to the
+// version it was updated from if the service can't be inspected.
+func (d *DockerClient) currentVersion(service *swarm.Service, ctx context.Context) uint64 {
+	updated, err := d.GetDockerService(service.ID, ctx)
+	if err != nil {
+		return service.Version.Index
+	}
+	return updated.Version.Index
+}
+
 func (d *DockerClient) GetDockerServices(ctx context.Context) ([]swarm.Service, error) {
-	services, err := d.dockerClient.ServiceList(ctx, types.ServiceListOptions{})
+	services, err := d.dockerClient.ServiceList(ctx, types.ServiceListOptions{Status: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get services: %v", err)
 	}
 	return services, nil
 }
 
+// GetDockerServiceWithStatus is GetDockerService with the running and desired task counts filled in.
+func (d *DockerClient) GetDockerServiceWithStatus(serviceName string, ctx context.Context) (*swarm.Service, error) {
+	service, err := d.GetDockerService(serviceName, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := d.dockerClient.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("id", service.ID)),
+		Status:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service status: %v", err)
+	}
+	for _, svc := range services {
+		if svc.ID == service.ID {
+			return &svc, nil
+		}
+	}
+	return service, nil
+}
+
+func (d *DockerClient) GetDockerTasks(serviceName string, ctx context.Context) ([]swarm.Task, error) {
+	tasks, err := d.dockerClient.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", serviceName)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %v", err)
+	}
+	return tasks, nil
+}
+
+type ServiceLogsOptions struct {
+	Follow     bool
+	Since      string // RFC3339, unix timestamp or a relative duration such as "10m"
+	Tail       string // number of lines or "all"
+	Timestamps bool
+}
+
+// ServiceLogs is an open log stream of a service.
+type ServiceLogs struct {
+	logs io.ReadCloser
+	tty  bool
+	ctx  context.Context
+}
+
+// OpenDockerServiceLogs opens the service's log stream. Errors from Docker, such as an
+// invalid since value, are returned here, before anything has been read.
+func (d *DockerClient) OpenDockerServiceLogs(serviceName string, opts ServiceLogsOptions, ctx context.Context) (*ServiceLogs, error) {
+	service, err := d.GetDockerService(serviceName, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := d.dockerClient.ServiceLogs(ctx, service.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service logs: %w", err)
+	}
+
+	// TTY services send a raw stream rather than multiplexed stdout/stderr frames
+	cs := service.Spec.TaskTemplate.ContainerSpec
+	return &ServiceLogs{logs: logs, tty: cs != nil && cs.TTY, ctx: ctx}, nil
+}
+
+// Copy copies the logs into stdout and stderr until the stream ends or its context is
+// cancelled.
+func (l *ServiceLogs) Copy(stdout, stderr io.Writer) error {
+	var err error
+	if l.tty {
+		_, err = io.Copy(stdout, l.logs)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, l.logs)
+	}
+	if err != nil && l.ctx.Err() == nil {
+		return fmt.Errorf("failed to read service logs: %v", err)
+	}
+	return nil
+}
+
+func (l *ServiceLogs) Close() error {
+	return l.logs.Close()
+}
+
+// GetDockerNodeNames maps node IDs to their hostnames.
+func (d *DockerClient) GetDockerNodeNames(ctx context.Context) (map[string]string, error) {
+	nodes, err := d.dockerClient.NodeList(ctx, types.NodeListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %v", err)
+	}
+
+	names := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		names[node.ID] = node.Description.Hostname
+	}
+	return names, nil
+}
+
+// WaitForServiceConvergence polls the service until its rollout has completed, paused or
+// rolled back, or until ctx is done, in which case the last observed state is reported as a timeout.
+func (d *DockerClient) WaitForServiceConvergence(serviceName string, since time.Time, ctx context.Context) (*RolloutStatus, error) {
+	ticker := time.NewTicker(convergencePollInterval)
+	defer ticker.Stop()
+
+	var last *RolloutStatus
+	for {
+		status, done, err := d.rolloutStatus(serviceName, since, ctx)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+		if err == nil {
+			last = status
+			if done {
+				last.Elapsed = time.Since(since).Round(time.Millisecond).String()
+				return last, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				last = &RolloutStatus{}
+			}
+			last.Message = fmt.Sprintf("gave up waiting in state %q", last.State)
+			last.State = RolloutStateTimeout
+			last.Elapsed = time.Since(since).Round(time.Millisecond).String()
+			return last, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *DockerClient) rolloutStatus(serviceName string, since time.Time, ctx context.Context) (*RolloutStatus, bool, error) {
+	service, err := d.GetDockerService(serviceName, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tasks, err := d.GetDockerTasks(service.ID, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	status := &RolloutStatus{TaskErrors: taskErrors(tasks, since)}
+
+	// Only trust UpdateStatus if it belongs to the update we started
+	if us := service.UpdateStatus; us != nil && us.StartedAt != nil && !us.StartedAt.Before(since) {
+		status.State = string(us.State)
+		status.Message = us.Message
+		switch us.State {
+		case swarm.UpdateStateCompleted, swarm.UpdateStatePaused, swarm.UpdateStateRollbackCompleted, swarm.UpdateStateRollbackPaused:
+			return status, true, nil
+		}
+		return status, false, nil
+	}
+
+	// No rolling update recorded yet (or none needed), so look at the tasks directly
+	status.State = string(swarm.UpdateStateUpdating)
+	image := service.Spec.TaskTemplate.ContainerSpec.Image
+	for _, t := range tasks {
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		if t.Status.State != swarm.TaskStateRunning || t.Spec.ContainerSpec == nil || t.Spec.ContainerSpec.Image != image {
+			return status, false, nil
+		}
+	}
+	status.State = string(swarm.UpdateStateCompleted)
+	return status, true, nil
+}
+
+func taskErrors(tasks []swarm.Task, since time.Time) []TaskError {
+	errs := []TaskError{}
+	for _, t := range tasks {
+		if t.Status.Err == "" || t.Status.Timestamp.Before(since) {
+			continue
+		}
+		te := TaskError{
+			TaskID: t.ID,
+			NodeID: t.NodeID,
+			State:  string(t.Status.State),
+			Error:  t.Status.Err,
+		}
+		if t.Status.ContainerStatus != nil {
+			te.ExitCode = t.Status.ContainerStatus.ExitCode
+		}
+		errs = append(errs, te)
+	}
+	return errs
+}
+
 func (d *DockerClient) GetDockerEvents(ctx context.Context, eventFilter filters.Args) (<-chan events.Message, <-chan error) {
 	return d.dockerClient.Events(ctx, events.ListOptions{
 		Filters: eventFilter,
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// encodedRegistryAuth returns the X-Registry-Auth value for the registry hosting image,
+// or an empty string when no credentials are configured for it.
+func (d *DockerClient) encodedRegistryAuth(image string) (string, error) {
+	if len(d.registryAuths) == 0 {
+		return "", nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %v", image, err)
+	}
+
+	host, creds, ok := d.registryAuths.For(named)
+	if !ok {
+		return "", nil
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+		ServerAddress: host,
+	})
+}
+
+// ResolveImageDigest looks up the content digest of image in its registry and returns the
+// image pinned to it (repo:tag@sha256:...) together with the digest, like the docker CLI
+// does on service update. Images that already carry a digest are returned unchanged.
+func (d *DockerClient) ResolveImageDigest(image string, ctx context.Context) (string, string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid image reference %q: %v", image, err)
+	}
+
+	if canonical, ok := named.(reference.Canonical); ok {
+		return image, canonical.Digest().String(), nil
+	}
+
+	encodedAuth, err := d.encodedRegistryAuth(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	inspect, err := d.dockerClient.DistributionInspect(ctx, image, encodedAuth)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve digest for %s: %v", image, err)
+	}
+
+	pinned, err := reference.WithDigest(reference.TagNameOnly(named), inspect.Descriptor.Digest)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to pin %s: %v", image, err)
+	}
+	return reference.FamiliarString(pinned), inspect.Descriptor.Digest.String(), nil
+}
+
+// ImageDigest returns the digest an image reference is pinned to, or an empty string.
+func ImageDigest(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String()
+	}
+	return ""
+}
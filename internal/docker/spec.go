@@ -0,0 +1,173 @@
+package docker
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-units"
+)
+
+// ServiceUpdateSpec describes the changes to apply onto a service's current spec.
+// Zero values leave the corresponding part of the spec untouched.
+type ServiceUpdateSpec struct {
+	Image       string            `json:"image,omitempty"`
+	EnvAdd      map[string]string `json:"envAdd,omitempty"`
+	EnvRemove   []string          `json:"envRemove,omitempty"`
+	LabelAdd    map[string]string `json:"labelAdd,omitempty"`
+	LabelRemove []string          `json:"labelRemove,omitempty"`
+	Replicas    *uint64           `json:"replicas,omitempty"`
+	Limits      *ResourceLimits   `json:"limits,omitempty"`
+	Force       bool              `json:"force,omitempty"`
+}
+
+type ResourceLimits struct {
+	CPUs   *float64 `json:"cpus,omitempty"`
+	Memory string   `json:"memory,omitempty"` // e.g. "512M", "1g"
+	Pids   *int64   `json:"pids,omitempty"`
+}
+
+// ValidationError reports an update that can't be applied to the service's spec, such as
+// an unparsable limit, as opposed to a failure talking to Docker.
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+func invalidUpdate(format string, args ...any) error {
+	return &ValidationError{msg: fmt.Sprintf(format, args...)}
+}
+
+// reservedLabelPrefixes are the label namespaces that control deploy permissions,
+// policies and tunnel routing. Changing them needs access to the swarm itself.
+var reservedLabelPrefixes = []string{"swarmctl.", "cloudflared."}
+
+func reservedLabel(key string) bool {
+	for _, prefix := range reservedLabelPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u ServiceUpdateSpec) IsEmpty() bool {
+	return u.Image == "" &&
+		len(u.EnvAdd) == 0 && len(u.EnvRemove) == 0 &&
+		len(u.LabelAdd) == 0 && len(u.LabelRemove) == 0 &&
+		u.Replicas == nil && u.Limits == nil && !u.Force
+}
+
+// apply mutates spec in place. The image is handled by the caller so it can be pinned first.
+func (u ServiceUpdateSpec) apply(spec *swarm.ServiceSpec) error {
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	if containerSpec == nil {
+		return fmt.Errorf("service %s has no container spec", spec.Name)
+	}
+
+	if len(u.EnvAdd) > 0 || len(u.EnvRemove) > 0 {
+		containerSpec.Env = applyEnv(containerSpec.Env, u.EnvAdd, u.EnvRemove)
+	}
+
+	if len(u.LabelAdd) > 0 || len(u.LabelRemove) > 0 {
+		for _, k := range slices.Concat(slices.Collect(maps.Keys(u.LabelAdd)), u.LabelRemove) {
+			if reservedLabel(k) {
+				return invalidUpdate("label %s controls swarmctl or the tunnel and can't be changed through the API", k)
+			}
+		}
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		for _, k := range u.LabelRemove {
+			delete(spec.Labels, k)
+		}
+		for k, v := range u.LabelAdd {
+			spec.Labels[k] = v
+		}
+	}
+
+	if u.Replicas != nil {
+		if spec.Mode.Replicated == nil {
+			return invalidUpdate("replicas can only be set on replicated services")
+		}
+		replicas := *u.Replicas
+		spec.Mode.Replicated.Replicas = &replicas
+	}
+
+	if u.Limits != nil {
+		if spec.TaskTemplate.Resources == nil {
+			spec.TaskTemplate.Resources = &swarm.ResourceRequirements{}
+		}
+		if spec.TaskTemplate.Resources.Limits == nil {
+			spec.TaskTemplate.Resources.Limits = &swarm.Limit{}
+		}
+		limits := spec.TaskTemplate.Resources.Limits
+
+		if u.Limits.CPUs != nil {
+			if *u.Limits.CPUs < 0 {
+				return invalidUpdate("invalid cpu limit %v", *u.Limits.CPUs)
+			}
+			limits.NanoCPUs = int64(math.Round(*u.Limits.CPUs * 1e9))
+		}
+		if u.Limits.Memory != "" {
+			bytes, err := units.RAMInBytes(u.Limits.Memory)
+			if err != nil {
+				return invalidUpdate("invalid memory limit %q: %v", u.Limits.Memory, err)
+			}
+			limits.MemoryBytes = bytes
+		}
+		if u.Limits.Pids != nil {
+			limits.Pids = *u.Limits.Pids
+		}
+	}
+
+	if u.Force {
+		spec.TaskTemplate.ForceUpdate++
+	}
+
+	return nil
+}
+
+// applyEnv removes and then sets KEY=VALUE entries, keeping the order of existing variables.
+func applyEnv(env []string, add map[string]string, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, k := range remove {
+		removed[k] = true
+	}
+
+	result := []string{}
+	set := make(map[string]bool, len(add))
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if v, ok := add[k]; ok {
+			if !set[k] {
+				result = append(result, k+"="+v)
+				set[k] = true
+			}
+			continue
+		}
+		if removed[k] {
+			continue
+		}
+		result = append(result, kv)
+	}
+
+	newKeys := []string{}
+	for k := range add {
+		if !set[k] {
+			newKeys = append(newKeys, k)
+		}
+	}
+	sort.Strings(newKeys)
+	for _, k := range newKeys {
+		result = append(result, k+"="+add[k])
+	}
+	return result
+}
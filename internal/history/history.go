@@ -0,0 +1,48 @@
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexraskin/swarmctl/internal/jsonl"
+)
+
+// Deployment is one change to a service's image, as applied by swarmctl.
+type Deployment struct {
+	Time        time.Time `json:"time"`
+	Service     string    `json:"service"`
+	Action      string    `json:"action"`
+	Image       string    `json:"image"`
+	Digest      string    `json:"digest,omitempty"`
+	OldVersion  uint64    `json:"oldVersion"`
+	NewVersion  uint64    `json:"newVersion"`
+	TriggeredBy string    `json:"triggeredBy"`
+	RequestID   string    `json:"requestId,omitempty"`
+	Revision    string    `json:"revision,omitempty"`
+	Source      string    `json:"source,omitempty"`
+}
+
+type Store struct {
+	file *jsonl.File[Deployment]
+}
+
+func Open(path string) (*Store, error) {
+	file, err := jsonl.Open[Deployment](path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open deployment history: %w", err)
+	}
+	return &Store{file: file}, nil
+}
+
+func (s *Store) Append(d Deployment) error {
+	return s.file.Append(d)
+}
+
+// List returns the service's deployments, newest first.
+func (s *Store) List(service string, limit int) ([]Deployment, error) {
+	return s.file.Read(func(d Deployment) bool { return d.Service == service }, limit)
+}
+
+func (s *Store) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,87 @@
+package jsonl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is an append-only file with one JSON encoded record per line.
+type File[T any] struct {
+	mu   sync.Mutex // serializes appends; reads open the file themselves
+	path string
+	file *os.File
+}
+
+func Open[T any](path string) (*File[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return &File[T]{path: path, file: file}, nil
+}
+
+func (f *File[T]) Append(record T) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", f.path, err)
+	}
+	return f.file.Sync()
+}
+
+// Read returns the records for which keep returns true, newest first, and at most the
+// newest limit of them if limit is positive. The whole file is scanned either way. Reads
+// use their own file handle and don't block appends; a record still being written is
+// skipped like a torn line.
+func (f *File[T]) Read(keep func(T) bool, limit int) ([]T, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	defer file.Close()
+
+	records := []T{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var record T
+		// Skip lines that can't be parsed, e.g. one torn by a crash mid-write
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if !keep(record) {
+			continue
+		}
+		records = append(records, record)
+		if limit > 0 && len(records) > limit {
+			records = records[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+func (f *File[T]) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
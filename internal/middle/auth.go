@@ -1,21 +1,46 @@
 package middle
 
 import (
-	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"github.com/alexraskin/swarmctl/internal/metrics"
 )
 
-func AuthMiddleware(expectedToken string) func(http.Handler) http.Handler {
+// AuthMiddleware accepts the request if any of the authenticators recognises its bearer credential.
+func AuthMiddleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := r.Header.Get("Authorization")
-			if len(token) < 8 || subtle.ConstantTimeCompare([]byte(token[7:]), []byte(expectedToken)) != 1 {
+			secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || secret == "" {
 				metrics.IncrementAuthFailures()
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
+
+			for _, authenticator := range authenticators {
+				if token, ok := authenticator.Authenticate(r.Context(), secret); ok {
+					next.ServeHTTP(w, r.WithContext(withToken(r.Context(), token)))
+					return
+				}
+			}
+
+			metrics.IncrementAuthFailures()
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
+
+// RequireScope rejects requests whose token lacks scope. It must run after AuthMiddleware.
+func RequireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := TokenFromContext(r.Context())
+			if !ok || !token.HasScope(scope) {
+				metrics.IncrementAuthFailures()
+				http.Error(w, "Forbidden: token lacks the "+string(scope)+" scope", http.StatusForbidden)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -0,0 +1,319 @@
+package middle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	jwksRefreshInterval = 1 * time.Hour
+	jwksMinRefresh      = 1 * time.Minute // refetch at most this often for unknown key IDs
+	jwksFetchTimeout    = 10 * time.Second
+	jwtLeeway           = 1 * time.Minute
+)
+
+// jwtAlgorithms are the signature algorithms accepted from the issuer. Symmetric and
+// "none" algorithms are never accepted.
+var jwtAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.ES256, jose.ES384, jose.ES512,
+}
+
+// JWTConfig configures bearer JWT authentication, e.g. for GitHub Actions OIDC tokens.
+// Exactly one of JWKSURL or JWKSFile must be set.
+type JWTConfig struct {
+	Issuer   string    `json:"issuer"`
+	Audience string    `json:"audience"`
+	JWKSURL  string    `json:"jwksURL,omitempty"`
+	JWKSFile string    `json:"jwksFile,omitempty"`
+	Rules    []JWTRule `json:"rules"`
+}
+
+// JWTRule maps tokens whose claims match Claims onto an identity. Claim values may be
+// path.Match patterns such as "refs/heads/*". The first matching rule wins. Every rule
+// must constrain the repository or repository_owner claim.
+type JWTRule struct {
+	Name     string            `json:"name"`
+	Claims   map[string]string `json:"claims"`
+	Scopes   []Scope           `json:"scopes"`
+	Groups   []string          `json:"groups,omitempty"`
+	Services []string          `json:"services,omitempty"`
+}
+
+func ParseJWTConfig(raw string) (*JWTConfig, error) {
+	var cfg JWTConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT config: %w", err)
+	}
+	return &cfg, nil
+}
+
+type JWTAuthenticator struct {
+	cfg    JWTConfig
+	rules  []*Token
+	client *http.Client
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+func NewJWTAuthenticator(cfg *JWTConfig, logger *slog.Logger) (*JWTAuthenticator, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, fmt.Errorf("JWT config requires issuer and audience")
+	}
+	if (cfg.JWKSURL == "") == (cfg.JWKSFile == "") {
+		return nil, fmt.Errorf("JWT config requires exactly one of jwksURL or jwksFile")
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("JWT config has no rules")
+	}
+
+	a := &JWTAuthenticator{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		logger: logger,
+	}
+
+	// Each rule becomes the token identity for requests that match it
+	rules := &TokenRegistry{}
+	for _, rule := range cfg.Rules {
+		if err := validateJWTRule(rule); err != nil {
+			return nil, err
+		}
+		token := &Token{Name: rule.Name, Scopes: rule.Scopes, Groups: rule.Groups, Services: rule.Services}
+		if err := rules.validate(token); err != nil {
+			return nil, err
+		}
+		rules.tokens = append(rules.tokens, token)
+	}
+	a.rules = rules.tokens
+
+	if _, err := a.loadKeys(context.Background()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func validateJWTRule(rule JWTRule) error {
+	if len(rule.Claims) == 0 {
+		return fmt.Errorf("JWT rule %q has no claims to match", rule.Name)
+	}
+	for _, pattern := range rule.Claims {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("JWT rule %q: invalid pattern %q", rule.Name, pattern)
+		}
+	}
+
+	// A rule without a literal owner would accept tokens from any repository on the issuer
+	if owner, ok := rule.Claims["repository_owner"]; ok && literalOwner(owner) {
+		return nil
+	}
+	if repository, ok := rule.Claims["repository"]; ok {
+		owner, _, _ := strings.Cut(repository, "/")
+		if literalOwner(owner) {
+			return nil
+		}
+	}
+	return fmt.Errorf("JWT rule %q must match the repository or repository_owner claim with a literal owner", rule.Name)
+}
+
+// literalOwner reports whether owner names exactly one owner rather than a pattern.
+func literalOwner(owner string) bool {
+	return owner != "" && !strings.ContainsAny(owner, `*?[\`)
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, raw string) (*Token, bool) {
+	// Static tokens are not JWTs, so don't bother verifying them
+	if strings.Count(raw, ".") != 2 {
+		return nil, false
+	}
+
+	claims, err := a.verify(ctx, raw)
+	if err != nil {
+		a.logger.Debug("JWT rejected", "error", err)
+		return nil, false
+	}
+
+	for i, rule := range a.cfg.Rules {
+		if claimsMatch(claims, rule.Claims) {
+			return a.rules[i], true
+		}
+	}
+	a.logger.Debug("JWT matched no rule", "sub", claims["sub"])
+	return nil, false
+}
+
+func (a *JWTAuthenticator) verify(ctx context.Context, raw string) (map[string]any, error) {
+	token, err := jwt.ParseSigned(raw, jwtAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, fmt.Errorf("expected exactly one signature")
+	}
+
+	key, err := a.key(ctx, token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var standard jwt.Claims
+	var claims map[string]any
+	if err := token.Claims(key.Key, &standard, &claims); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	if standard.Expiry == nil {
+		return nil, fmt.Errorf("missing exp claim")
+	}
+	expected := jwt.Expected{
+		Issuer:      a.cfg.Issuer,
+		AnyAudience: jwt.Audience{a.cfg.Audience},
+		Time:        time.Now(),
+	}
+	if err := standard.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func claimsMatch(claims map[string]any, patterns map[string]string) bool {
+	for name, pattern := range patterns {
+		value, ok := claims[name]
+		if !ok {
+			return false
+		}
+		str, ok := value.(string)
+		if !ok {
+			str = fmt.Sprint(value)
+		}
+		if matched, _ := path.Match(pattern, str); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the verification key for kid, refreshing the key set when it is stale or
+// the key is unknown, e.g. after the issuer rotated its keys.
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	a.mu.Lock()
+	keys, fetchedAt := a.keys, a.fetchedAt
+	a.mu.Unlock()
+
+	key, ok := lookupKey(keys, kid)
+	stale := time.Since(fetchedAt) > jwksRefreshInterval
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	keys, err := a.loadKeys(ctx)
+	if err != nil {
+		// Keep using the previous keys if the issuer is briefly unreachable
+		if ok {
+			a.logger.Warn("Failed to refresh JWKS", "error", err)
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func lookupKey(keys *jose.JSONWebKeySet, kid string) (*jose.JSONWebKey, bool) {
+	if keys == nil {
+		return nil, false
+	}
+	if kid == "" && len(keys.Keys) == 1 {
+		return &keys.Keys[0], true
+	}
+	if found := keys.Key(kid); len(found) > 0 {
+		return &found[0], true
+	}
+	return nil, false
+}
+
+func (a *JWTAuthenticator) loadKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	var data []byte
+	var err error
+	if a.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(a.cfg.JWKSFile)
+	} else {
+		data, err = a.fetchJWKS(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.fetchedAt = time.Now()
+	a.mu.Unlock()
+	return keys, nil
+}
+
+func (a *JWTAuthenticator) fetchJWKS(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS keeps the public signing keys of a JWKS document.
+func parseJWKS(data []byte) (*jose.JSONWebKeySet, error) {
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := &jose.JSONWebKeySet{}
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		public := key.Public()
+		if !public.Valid() {
+			return nil, fmt.Errorf("JWKS key %q is not a valid public key", key.KeyID)
+		}
+		keys.Keys = append(keys.Keys, public)
+	}
+	if len(keys.Keys) == 0 {
+		return nil, errors.New("JWKS contains no signing keys")
+	}
+	return keys, nil
+}
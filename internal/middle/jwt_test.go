@@ -0,0 +1,259 @@
+package middle
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	testIssuer   = "https://token.actions.githubusercontent.com"
+	testAudience = "swarmctl"
+	testKeyID    = "key-1"
+)
+
+type jwtFixture struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+	auth   *JWTAuthenticator
+}
+
+func newJWTFixture(t *testing.T) *jwtFixture {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key: &key.PublicKey, KeyID: testKeyID, Algorithm: string(jose.RS256), Use: "sig",
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	auth, err := NewJWTAuthenticator(&JWTConfig{
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		JWKSURL:  server.URL,
+		Rules: []JWTRule{
+			{
+				Name:     "web-deploy",
+				Claims:   map[string]string{"repository": "acme/web", "ref": "refs/heads/main"},
+				Scopes:   []Scope{ScopeUpdate},
+				Services: []string{"web"},
+			},
+			{
+				Name:   "acme-read",
+				Claims: map[string]string{"repository_owner": "acme"},
+				Scopes: []Scope{ScopeRead},
+			},
+		},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &jwtFixture{key: key, server: server, auth: auth}
+}
+
+func (f *jwtFixture) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	opts := (&jose.SignerOptions{}).WithType("JWT").WithHeader(jose.HeaderKey("kid"), kid)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: f.key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":              testIssuer,
+		"aud":              testAudience,
+		"sub":              "repo:acme/web:ref:refs/heads/main",
+		"repository":       "acme/web",
+		"repository_owner": "acme",
+		"ref":              "refs/heads/main",
+		"iat":              now.Unix(),
+		"nbf":              now.Unix(),
+		"exp":              now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func TestJWTAuthenticateValid(t *testing.T) {
+	f := newJWTFixture(t)
+
+	token, ok := f.auth.Authenticate(context.Background(), f.sign(t, testKeyID, validClaims()))
+	if !ok {
+		t.Fatal("expected valid token to authenticate")
+	}
+	if token.Name != "web-deploy" {
+		t.Errorf("got rule %q, want web-deploy", token.Name)
+	}
+	if !token.HasScope(ScopeUpdate) || !token.AllowsService("web") || token.AllowsService("db") {
+		t.Errorf("token has unexpected permissions: %+v", token)
+	}
+}
+
+func TestJWTAuthenticateRuleMapping(t *testing.T) {
+	f := newJWTFixture(t)
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		rule   string
+	}{
+		{"first matching rule", map[string]any{}, "web-deploy"},
+		{"other branch falls through", map[string]any{"ref": "refs/heads/dev"}, "acme-read"},
+		{"other repo of the owner", map[string]any{"repository": "acme/api"}, "acme-read"},
+		{"other owner", map[string]any{"repository": "evil/web", "repository_owner": "evil"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			token, ok := f.auth.Authenticate(context.Background(), f.sign(t, testKeyID, claims))
+			if tt.rule == "" {
+				if ok {
+					t.Fatalf("expected no rule to match, got %q", token.Name)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("expected token to authenticate")
+			}
+			if token.Name != tt.rule {
+				t.Errorf("got rule %q, want %q", token.Name, tt.rule)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticateRejects(t *testing.T) {
+	f := newJWTFixture(t)
+
+	tests := []struct {
+		name   string
+		kid    string
+		claims map[string]any
+	}{
+		{"wrong kid", "key-2", nil},
+		{"expired", testKeyID, map[string]any{"exp": time.Now().Add(-10 * time.Minute).Unix()}},
+		{"missing exp", testKeyID, map[string]any{"exp": nil}},
+		{"not yet valid", testKeyID, map[string]any{"nbf": time.Now().Add(10 * time.Minute).Unix()}},
+		{"wrong audience", testKeyID, map[string]any{"aud": "someone-else"}},
+		{"wrong issuer", testKeyID, map[string]any{"iss": "https://evil.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			for k, v := range tt.claims {
+				if v == nil {
+					delete(claims, k)
+				} else {
+					claims[k] = v
+				}
+			}
+			if _, ok := f.auth.Authenticate(context.Background(), f.sign(t, tt.kid, claims)); ok {
+				t.Fatal("expected token to be rejected")
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticateRejectsUnsafeAlgorithms(t *testing.T) {
+	f := newJWTFixture(t)
+
+	encode := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	payload := encode(validClaims())
+
+	// alg "none" with an empty signature
+	none := encode(map[string]string{"alg": "none", "typ": "JWT", "kid": testKeyID}) + "." + payload + "."
+	if _, ok := f.auth.Authenticate(context.Background(), none); ok {
+		t.Error("accepted token with alg none")
+	}
+
+	// HS256 signed with the public key as the HMAC secret
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: f.key.PublicKey.N.Bytes()},
+		(&jose.SignerOptions{}).WithHeader(jose.HeaderKey("kid"), testKeyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256, err := jwt.Signed(signer).Claims(validClaims()).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.auth.Authenticate(context.Background(), hs256); ok {
+		t.Error("accepted token with alg HS256")
+	}
+
+	// Valid header and payload with a tampered signature
+	valid := f.sign(t, testKeyID, validClaims())
+	tampered := valid[:strings.LastIndex(valid, ".")+1] + encode("forged")
+	if _, ok := f.auth.Authenticate(context.Background(), tampered); ok {
+		t.Error("accepted token with tampered signature")
+	}
+}
+
+func TestNewJWTAuthenticatorRequiresRepositoryConstraint(t *testing.T) {
+	f := newJWTFixture(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name    string
+		claims  map[string]string
+		wantErr bool
+	}{
+		{"repository", map[string]string{"repository": "acme/web"}, false},
+		{"repository owner", map[string]string{"repository_owner": "acme"}, false},
+		{"ref only", map[string]string{"ref": "refs/heads/main"}, true},
+		{"repository of any branch", map[string]string{"repository": "acme/*", "ref": "refs/heads/*"}, false},
+		{"wildcard repository", map[string]string{"repository": "*"}, true},
+		{"wildcard owner and repository", map[string]string{"repository": "*/*"}, true},
+		{"wildcard owner", map[string]string{"repository": "*/web"}, true},
+		{"owner pattern", map[string]string{"repository": "ac?e/web"}, true},
+		{"owner class", map[string]string{"repository": "[a-z]*/web"}, true},
+		{"escaped owner", map[string]string{"repository": `\acme/web`}, true},
+		{"any owner", map[string]string{"repository_owner": "?*"}, true},
+		{"owner prefix", map[string]string{"repository_owner": "acme*"}, true},
+		{"empty owner", map[string]string{"repository_owner": ""}, true},
+		{"bypass owner with literal other claim", map[string]string{"repository_owner": "*", "ref": "refs/heads/main"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTAuthenticator(&JWTConfig{
+				Issuer:   testIssuer,
+				Audience: testAudience,
+				JWKSURL:  f.server.URL,
+				Rules:    []JWTRule{{Name: "ci", Claims: tt.claims, Scopes: []Scope{ScopeRead}}},
+			}, logger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package middle
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"
+	ScopeUpdate  Scope = "update"
+	ScopeMetrics Scope = "metrics"
+	ScopeApprove Scope = "approve"
+	ScopeAdmin   Scope = "admin" // implies every other scope
+)
+
+const hashPrefix = "sha256:"
+
+// Token is an API token entry. Hash holds "sha256:<hex>" of the secret, e.g. the
+// output of `echo -n "$TOKEN" | sha256sum`, so the registry never stores secrets.
+// Groups let a service label allow several tokens at once.
+type Token struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []Scope  `json:"scopes"`
+	Groups []string `json:"groups,omitempty"`
+	// Services optionally limits which services the token may deploy (path.Match patterns).
+	Services []string `json:"services,omitempty"`
+
+	hash []byte
+}
+
+// Authenticator resolves a bearer credential to the token it identifies.
+type Authenticator interface {
+	Authenticate(ctx context.Context, secret string) (*Token, bool)
+}
+
+func (t *Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
+
+// AllowsService reports whether the token may deploy the named service.
+func (t *Token) AllowsService(name string) bool {
+	if len(t.Services) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(t.Services, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// MatchesAny reports whether the token's name or one of its groups is in names.
+func (t *Token) MatchesAny(names []string) bool {
+	for _, name := range names {
+		if name == t.Name || slices.Contains(t.Groups, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type TokenRegistry struct {
+	tokens []*Token
+}
+
+type tokenFile struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+// LoadTokenRegistry parses a {"tokens": [...]} document. If legacyToken is set it is
+// registered as an admin token named "default", so a single AUTH_TOKEN keeps working.
+func LoadTokenRegistry(raw string, legacyToken string) (*TokenRegistry, error) {
+	registry := &TokenRegistry{}
+
+	if strings.TrimSpace(raw) != "" {
+		var file tokenFile
+		if err := json.Unmarshal([]byte(raw), &file); err != nil {
+			return nil, fmt.Errorf("failed to parse tokens: %w", err)
+		}
+		for _, t := range file.Tokens {
+			if err := registry.add(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if legacyToken != "" {
+		sum := sha256.Sum256([]byte(legacyToken))
+		if err := registry.add(&Token{
+			Name:   "default",
+			Hash:   hashPrefix + hex.EncodeToString(sum[:]),
+			Scopes: []Scope{ScopeAdmin},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+func (r *TokenRegistry) Len() int {
+	return len(r.tokens)
+}
+
+func (r *TokenRegistry) add(t *Token) error {
+	if err := r.validate(t); err != nil {
+		return err
+	}
+
+	hexHash, ok := strings.CutPrefix(t.Hash, hashPrefix)
+	if !ok {
+		return fmt.Errorf("token %q: hash must start with %q", t.Name, hashPrefix)
+	}
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("token %q: invalid sha256 hash", t.Name)
+	}
+	t.hash = hash
+
+	r.tokens = append(r.tokens, t)
+	return nil
+}
+
+// validate checks everything about a token except its secret.
+func (r *TokenRegistry) validate(t *Token) error {
+	if t.Name == "" {
+		return fmt.Errorf("token without a name")
+	}
+	if slices.ContainsFunc(r.tokens, func(existing *Token) bool { return existing.Name == t.Name }) {
+		return fmt.Errorf("duplicate token name %q", t.Name)
+	}
+
+	for _, scope := range t.Scopes {
+		switch scope {
+		case ScopeRead, ScopeUpdate, ScopeMetrics, ScopeApprove, ScopeAdmin:
+		default:
+			return fmt.Errorf("token %q: unknown scope %q", t.Name, scope)
+		}
+	}
+
+	for _, pattern := range t.Services {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("token %q: invalid service pattern %q", t.Name, pattern)
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the token whose hash matches secret.
+func (r *TokenRegistry) Authenticate(_ context.Context, secret string) (*Token, bool) {
+	sum := sha256.Sum256([]byte(secret))
+
+	var match *Token
+	for _, t := range r.tokens {
+		// Compare against every entry so timing doesn't reveal which one matched
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			match = t
+		}
+	}
+	return match, match != nil
+}
+
+type tokenContextKey struct{}
+
+func withToken(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, t)
+}
+
+// TokenFromContext returns the token that authenticated the request, if any.
+func TokenFromContext(ctx context.Context) (*Token, bool) {
+	t, ok := ctx.Value(tokenContextKey{}).(*Token)
+	return t, ok
+}
+
+// TokenName returns the name of the token that authenticated the request, or an empty string.
+func TokenName(ctx context.Context) string {
+	if t, ok := TokenFromContext(ctx); ok {
+		return t.Name
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Item is a deployment waiting to be applied.
+type Item struct {
+	ID          string    `json:"id"`
+	Service     string    `json:"service"`
+	Image       string    `json:"image"`
+	TriggeredBy string    `json:"triggeredBy"`
+	RequestID   string    `json:"requestId,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NotBefore   time.Time `json:"notBefore,omitzero"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// Store is a small set of pending items kept in a JSON file, rewritten on every change
+// so it survives restarts.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	items []Item
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	s := &Store{path: path, items: []Item{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &s.items); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Add stores item, assigning it an ID and creation time. Items already pending for the
+// same service are replaced, since only the latest requested image matters; they are
+// returned so the caller can report them.
+func (s *Store) Add(item Item) (Item, []Item, error) {
+	id, err := newID()
+	if err != nil {
+		return Item{}, nil, err
+	}
+	item.ID = id
+	item.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replaced []Item
+	items := []Item{}
+	for _, existing := range s.items {
+		if existing.Service == item.Service {
+			replaced = append(replaced, existing)
+			continue
+		}
+		items = append(items, existing)
+	}
+	items = append(items, item)
+
+	if err := s.save(items); err != nil {
+		return Item{}, nil, err
+	}
+	s.items = items
+	return item, replaced, nil
+}
+
+// Get returns the item with the given ID.
+func (s *Store) Get(id string) (Item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.items, func(item Item) bool { return item.ID == id })
+	if i < 0 {
+		return Item{}, false
+	}
+	return s.items[i], true
+}
+
+// Remove deletes the item with the given ID and returns it. Removing is how callers
+// claim an item, so only one of them acts on it.
+func (s *Store) Remove(id string) (Item, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.items, func(item Item) bool { return item.ID == id })
+	if i < 0 {
+		return Item{}, false, nil
+	}
+	item := s.items[i]
+
+	items := slices.Delete(slices.Clone(s.items), i, i+1)
+	if err := s.save(items); err != nil {
+		return Item{}, false, err
+	}
+	s.items = items
+	return item, true, nil
+}
+
+// List returns all pending items, oldest first.
+func (s *Store) List() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.items)
+}
+
+// save writes items to a temporary file and renames it over the store, so a crash
+// never leaves a half-written file behind.
+func (s *Store) save(items []Item) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
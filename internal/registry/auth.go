@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+type Credentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+// Auths maps registry hosts, as reported by reference.Domain, to their credentials.
+type Auths map[string]Credentials
+
+// authFile mirrors the "auths" section of a docker config.json, so an
+// existing config can be mounted as a secret unchanged.
+type authFile struct {
+	Auths map[string]authEntry `json:"auths"`
+}
+
+type authEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+func ParseAuths(raw string) (Auths, error) {
+	auths := make(Auths)
+	if strings.TrimSpace(raw) == "" {
+		return auths, nil
+	}
+
+	var file authFile
+	if err := json.Unmarshal([]byte(raw), &file); err != nil {
+		return nil, fmt.Errorf("failed to parse registry auth: %v", err)
+	}
+
+	for key, entry := range file.Auths {
+		creds := Credentials{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+		}
+
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for registry %s: %v", key, err)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid auth for registry %s: expected username:password", key)
+			}
+			creds.Username = username
+			creds.Password = password
+		}
+
+		auths[NormalizeHost(key)] = creds
+	}
+	return auths, nil
+}
+
+// For returns the credentials for the registry hosting named, if any.
+func (a Auths) For(named reference.Named) (string, Credentials, bool) {
+	host := reference.Domain(named)
+	creds, ok := a[host]
+	return host, creds, ok
+}
+
+// NormalizeHost turns config keys such as "https://index.docker.io/v1/" into the
+// domain reference.Domain reports for an image, e.g. "docker.io".
+func NormalizeHost(key string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.ToLower(host)
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
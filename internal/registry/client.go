@@ -0,0 +1,322 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+const (
+	requestTimeout  = 30 * time.Second
+	maxResponseSize = 4 << 20
+
+	mediaTypeOCIIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest     = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList      = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest  = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerHubRegistryAPIHost = "registry-1.docker.io"
+)
+
+// Client talks to the registry HTTP API (distribution spec v2) for the things the Docker
+// Engine API does not expose, such as image config labels.
+type Client struct {
+	auths Auths
+	http  *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // repository scope -> bearer token
+}
+
+func NewClient(auths Auths) *Client {
+	return &Client{
+		auths:  auths,
+		http:   &http.Client{Timeout: requestTimeout},
+		tokens: make(map[string]string),
+	}
+}
+
+// ImageConfig is the subset of an image's config blob swarmctl uses.
+type ImageConfig struct {
+	Labels map[string]string
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// GetImageConfig fetches the config of image. For multi-platform images the config of
+// the linux image for this machine's architecture is returned.
+func (c *Client) GetImageConfig(ctx context.Context, image string) (*ImageConfig, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %v", image, err)
+	}
+
+	ref := "latest"
+	if canonical, ok := named.(reference.Canonical); ok {
+		ref = canonical.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		ref = tagged.Tag()
+	}
+
+	m, err := c.getManifest(ctx, named, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Manifests) > 0 {
+		digest := ""
+		for _, entry := range m.Manifests {
+			if entry.Platform.OS == "linux" && entry.Platform.Architecture == runtime.GOARCH {
+				digest = entry.Digest
+				break
+			}
+		}
+		if digest == "" {
+			return nil, fmt.Errorf("no linux/%s image in %s", runtime.GOARCH, image)
+		}
+		if m, err = c.getManifest(ctx, named, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest for %s has no config", image)
+	}
+
+	var blob struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := c.getJSON(ctx, named, "blobs/"+m.Config.Digest, "", &blob); err != nil {
+		return nil, fmt.Errorf("failed to get image config: %w", err)
+	}
+	return &ImageConfig{Labels: blob.Config.Labels}, nil
+}
+
+// ListTags returns every tag of the repository image belongs to, following the
+// registry's pagination.
+func (c *Client) ListTags(ctx context.Context, image string) ([]string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %v", image, err)
+	}
+
+	tags := []string{}
+	path := "tags/list?n=1000"
+	for path != "" {
+		resp, err := c.get(ctx, named, path, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tag list: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+
+		path = nextTagsPage(resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// nextTagsPage turns a `</v2/repo/tags/list?last=x&n=1000>; rel="next"` Link header into
+// the path of the next page, or an empty string on the last page.
+func nextTagsPage(link string) string {
+	target, params, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	next, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+	if err != nil || next.RawQuery == "" {
+		return ""
+	}
+	return "tags/list?" + next.RawQuery
+}
+
+func (c *Client) getManifest(ctx context.Context, named reference.Named, ref string) (*manifest, error) {
+	accept := strings.Join([]string{mediaTypeOCIIndex, mediaTypeOCIManifest, mediaTypeDockerList, mediaTypeDockerManifest}, ", ")
+
+	var m manifest
+	if err := c.getJSON(ctx, named, "manifests/"+ref, accept, &m); err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s: %w", ref, err)
+	}
+	return &m, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, named reference.Named, path, accept string, v any) error {
+	resp, err := c.get(ctx, named, path, accept)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// get performs an authenticated GET against /v2/<repository>/<path>, handling the
+// registry token handshake when the registry asks for it.
+func (c *Client) get(ctx context.Context, named reference.Named, path, accept string) (*http.Response, error) {
+	host, creds, hasCreds := c.auths.For(named)
+	repository := reference.Path(named)
+	endpoint := fmt.Sprintf("%s/v2/%s/%s", registryBaseURL(host), repository, path)
+
+	do := func(authorize func(*http.Request)) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		authorize(req)
+		return c.http.Do(req)
+	}
+
+	scope := "repository:" + repository + ":pull"
+	c.mu.Lock()
+	token := c.tokens[host+"/"+scope]
+	c.mu.Unlock()
+
+	resp, err := do(func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		scheme, params := parseChallenge(challenge)
+		switch scheme {
+		case "bearer":
+			token, err := c.fetchToken(ctx, params, scope, creds, hasCreds)
+			if err != nil {
+				return nil, err
+			}
+			c.mu.Lock()
+			c.tokens[host+"/"+scope] = token
+			c.mu.Unlock()
+			resp, err = do(func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) })
+		case "basic":
+			if !hasCreds {
+				return nil, fmt.Errorf("registry %s requires credentials", host)
+			}
+			resp, err = do(func(req *http.Request) { req.SetBasicAuth(creds.Username, creds.Password) })
+		default:
+			return nil, fmt.Errorf("unsupported auth challenge from %s: %q", host, challenge)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, endpoint)
+	}
+	return resp, nil
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, scope string, creds Credentials, hasCreds bool) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("auth challenge has no realm")
+	}
+
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCreds {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(header, " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+func registryBaseURL(host string) string {
+	if host == "docker.io" {
+		return "https://" + dockerHubRegistryAPIHost
+	}
+	// Local registries, e.g. a registry:2 container used for testing, usually serve plain HTTP
+	if h, _, _ := strings.Cut(host, ":"); h == "localhost" || h == "127.0.0.1" {
+		return "http://" + host
+	}
+	return "https://" + host
+}
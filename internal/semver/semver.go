@@ -0,0 +1,137 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is an image tag that looks like a version, such as "1.4", "v2.0.1" or
+// "16.2-alpine". Tags may omit the minor and patch numbers; the part after the first
+// "-" is kept as a suffix so variants like "-alpine" are only compared with each other.
+type Version struct {
+	Prefix     string // "v" or ""
+	Major      int
+	Minor      int
+	Patch      int
+	Suffix     string
+	Components int // how many of major, minor and patch the tag spells out
+}
+
+// Parse parses an image tag as a version.
+func Parse(tag string) (Version, error) {
+	var v Version
+	rest := tag
+	if trimmed, ok := strings.CutPrefix(rest, "v"); ok {
+		v.Prefix = "v"
+		rest = trimmed
+	}
+	rest, v.Suffix, _ = strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("tag %q is not a version", tag)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || strings.TrimLeft(part, "0123456789") != "" {
+			return Version{}, fmt.Errorf("tag %q is not a version", tag)
+		}
+		*numbers[i] = n
+	}
+	v.Components = len(parts)
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower, equal to or higher than o.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// sameShape reports whether two tags are written the same way, so a service tracking
+// "16-alpine" is never moved to "16.3" or "v16.3-alpine".
+func (v Version) sameShape(o Version) bool {
+	return v.Prefix == o.Prefix && v.Suffix == o.Suffix && v.Components == o.Components
+}
+
+// Policy limits which versions a service may move to.
+type Policy struct {
+	raw   string
+	kind  string // "major", "minor", "patch", "~" or "^"
+	bound Version
+}
+
+// ParsePolicy parses an update policy: "major", "minor" or "patch" relative to the
+// running version, "~1.4" for any 1.4.x, or "^1.4" for any 1.x from 1.4 on.
+func ParsePolicy(raw string) (Policy, error) {
+	raw = strings.TrimSpace(raw)
+	switch raw {
+	case "major", "minor", "patch":
+		return Policy{raw: raw, kind: raw}, nil
+	}
+
+	for _, kind := range []string{"~", "^"} {
+		constraint, ok := strings.CutPrefix(raw, kind)
+		if !ok {
+			continue
+		}
+		bound, err := Parse(strings.TrimPrefix(constraint, "v"))
+		if err != nil || bound.Suffix != "" {
+			return Policy{}, fmt.Errorf("invalid update policy %q", raw)
+		}
+		return Policy{raw: raw, kind: kind, bound: bound}, nil
+	}
+	return Policy{}, fmt.Errorf("invalid update policy %q, must be major, minor, patch, ~X.Y or ^X.Y", raw)
+}
+
+func (p Policy) String() string {
+	return p.raw
+}
+
+// Allows reports whether a service running current may be moved to candidate.
+func (p Policy) Allows(current, candidate Version) bool {
+	if !current.sameShape(candidate) {
+		return false
+	}
+
+	switch p.kind {
+	case "major":
+		return true
+	case "minor":
+		return candidate.Major == current.Major
+	case "patch":
+		return candidate.Major == current.Major && candidate.Minor == current.Minor
+	case "~":
+		// ~1 allows 1.x, ~1.4 and ~1.4.2 allow 1.4.x from the bound on
+		if candidate.Compare(p.bound) < 0 || candidate.Major != p.bound.Major {
+			return false
+		}
+		return p.bound.Components == 1 || candidate.Minor == p.bound.Minor
+	case "^":
+		return candidate.Compare(p.bound) >= 0 && candidate.Major == p.bound.Major
+	}
+	return false
+}
+
+// Latest returns the highest of tags that is newer than current and allowed by the
+// policy, or false if there is none.
+func (p Policy) Latest(current Version, tags []string) (string, bool) {
+	best, bestTag := current, ""
+	for _, tag := range tags {
+		candidate, err := Parse(tag)
+		if err != nil || !p.Allows(current, candidate) || candidate.Compare(best) <= 0 {
+			continue
+		}
+		best, bestTag = candidate, tag
+	}
+	return bestTag, bestTag != ""
+}
@@ -0,0 +1,139 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    Version
+		wantErr bool
+	}{
+		{tag: "1", want: Version{Major: 1, Components: 1}},
+		{tag: "1.4", want: Version{Major: 1, Minor: 4, Components: 2}},
+		{tag: "1.4.2", want: Version{Major: 1, Minor: 4, Patch: 2, Components: 3}},
+		{tag: "v2.0.1", want: Version{Prefix: "v", Major: 2, Patch: 1, Components: 3}},
+		{tag: "16-alpine", want: Version{Major: 16, Suffix: "alpine", Components: 1}},
+		{tag: "16.2-alpine3.20", want: Version{Major: 16, Minor: 2, Suffix: "alpine3.20", Components: 2}},
+		{tag: "latest", wantErr: true},
+		{tag: "", wantErr: true},
+		{tag: "1.2.3.4", wantErr: true},
+		{tag: "1..2", wantErr: true},
+		{tag: "+1.2", wantErr: true},
+		{tag: "1.2b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := Parse(tt.tag)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	for _, raw := range []string{"", "any", "~", "^latest", "~1.4-alpine", ">=1.4", "1.4"} {
+		if _, err := ParsePolicy(raw); err == nil {
+			t.Errorf("ParsePolicy(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		policy, current, candidate string
+		want                       bool
+	}{
+		{"patch", "1.4.2", "1.4.9", true},
+		{"patch", "1.4.2", "1.5.0", false},
+		{"minor", "1.4.2", "1.9.0", true},
+		{"minor", "1.4.2", "2.0.0", false},
+		{"major", "1.4.2", "3.0.0", true},
+
+		{"~1", "1.4.2", "1.9.0", true},
+		{"~1", "1.4.2", "2.0.0", false},
+		{"~1.4", "1.4.2", "1.4.9", true},
+		{"~1.4", "1.4.2", "1.5.0", false},
+		{"~1.4.2", "1.4.2", "1.4.3", true},
+		{"~1.4.2", "1.4.2", "1.4.1", false},
+		{"~1.4.2", "1.4.2", "1.5.0", false},
+		{"^1.4", "1.4.2", "1.9.0", true},
+		{"^1.4", "1.4.2", "1.3.9", false},
+		{"^1.4", "1.4.2", "2.0.0", false},
+		{"^v1.4", "1.4.2", "1.5.0", true},
+
+		// Tags only move to tags written the same way
+		{"major", "16-alpine", "17-alpine", true},
+		{"major", "16-alpine", "16.3", false},
+		{"major", "16-alpine", "17", false},
+		{"major", "16-alpine", "17-bookworm", false},
+		{"major", "16.3", "16.3.1", false},
+		{"major", "v1.2", "v1.3", true},
+		{"major", "v1.2", "1.3", false},
+		{"major", "1.2", "v1.3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.current+" to "+tt.candidate, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, err := Parse(tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			candidate, err := Parse(tt.candidate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policy.Allows(current, candidate); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+	tags := []string{"latest", "1.3.0", "1.4.1", "1.4.2", "1.4.10", "1.5.0", "2.0.0", "1.4.3-alpine", "v1.4.5", "1.4"}
+
+	tests := []struct {
+		name, policy, current string
+		want                  string
+		wantOK                bool
+	}{
+		{"highest patch", "patch", "1.4.2", "1.4.10", true},
+		{"highest minor", "minor", "1.4.2", "1.5.0", true},
+		{"highest major", "major", "1.4.2", "2.0.0", true},
+		{"tilde", "~1.4", "1.4.1", "1.4.10", true},
+		{"caret", "^1.4", "1.4.1", "1.5.0", true},
+		{"already newest", "patch", "1.4.10", "", false},
+		{"never downgrades", "~1.4", "1.4.20", "", false},
+		{"same shape only", "major", "1.4-alpine", "", false},
+		{"prefixed tags", "patch", "v1.4.1", "v1.4.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, err := Parse(tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := policy.Latest(current, tags)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
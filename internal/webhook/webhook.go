@@ -0,0 +1,215 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// Push is an image push reported by a registry.
+type Push struct {
+	Repository string // normalized repository name, e.g. "docker.io/library/nginx"
+	Tag        string
+	Digest     string // empty when the registry does not report it
+}
+
+// Image returns the pushed image as repo:tag, pinned to the pushed digest when the
+// registry reports one.
+func (p Push) Image() string {
+	switch {
+	case p.Tag == "":
+		return p.Repository + "@" + p.Digest
+	case p.Digest == "":
+		return p.Repository + ":" + p.Tag
+	default:
+		return p.Repository + ":" + p.Tag + "@" + p.Digest
+	}
+}
+
+// Matches reports whether image refers to the pushed repository and tag.
+func (p Push) Matches(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil || named.Name() != p.Repository {
+		return false
+	}
+	tag := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	} else if _, ok := named.(reference.Canonical); ok {
+		// Digest-only references can't follow a tag
+		return false
+	}
+	return tag == p.Tag
+}
+
+func newPush(repository, tag, digest string) (*Push, error) {
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository %q: %w", repository, err)
+	}
+	if tag == "" && digest == "" {
+		return nil, fmt.Errorf("push for %s has neither tag nor digest", repository)
+	}
+	return &Push{Repository: named.Name(), Tag: tag, Digest: digest}, nil
+}
+
+// VerifySecret compares a shared secret in constant time.
+func VerifySecret(expected, got string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(got)) == 1
+}
+
+// VerifyGitHubSignature checks the X-Hub-Signature-256 header against the body.
+func VerifyGitHubSignature(secret string, body []byte, header string) bool {
+	got, ok := strings.CutPrefix(header, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	sig, err := hex.DecodeString(got)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+type dockerHubPayload struct {
+	PushData struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+// ParseDockerHub parses a Docker Hub repository webhook.
+func ParseDockerHub(body []byte) (*Push, error) {
+	var payload dockerHubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid Docker Hub payload: %w", err)
+	}
+	if payload.Repository.RepoName == "" {
+		return nil, fmt.Errorf("Docker Hub payload has no repository")
+	}
+	return newPush(payload.Repository.RepoName, payload.PushData.Tag, "")
+}
+
+type githubPackage struct {
+	Name        string `json:"name"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion struct {
+		Version           string `json:"version"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+type githubPayload struct {
+	Action          string         `json:"action"`
+	Package         *githubPackage `json:"package"`
+	RegistryPackage *githubPackage `json:"registry_package"`
+}
+
+// ParseGitHubPackage parses a GitHub "package" or "registry_package" webhook. It returns
+// nil without an error for events that are not container pushes, such as pings.
+func ParseGitHubPackage(event string, body []byte) (*Push, error) {
+	if event != "package" && event != "registry_package" {
+		return nil, nil
+	}
+
+	var payload githubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid GitHub payload: %w", err)
+	}
+
+	pkg := payload.Package
+	if pkg == nil {
+		pkg = payload.RegistryPackage
+	}
+	if pkg == nil || payload.Action != "published" || !strings.EqualFold(pkg.PackageType, "container") {
+		return nil, nil
+	}
+
+	version := pkg.PackageVersion
+	digest := version.ContainerMetadata.Tag.Digest
+	if digest == "" && strings.HasPrefix(version.Version, "sha256:") {
+		digest = version.Version
+	}
+
+	repository := fmt.Sprintf("ghcr.io/%s/%s", strings.ToLower(pkg.Owner.Login), strings.ToLower(pkg.Name))
+	return newPush(repository, version.ContainerMetadata.Tag.Name, digest)
+}
+
+// manifestMediaTypes are the media types a registry reports for image manifest pushes.
+// Blob pushes and anything else in the envelope are ignored.
+var manifestMediaTypes = map[string]bool{
+	"application/vnd.docker.distribution.manifest.v2+json":      true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+	"application/vnd.oci.image.manifest.v1+json":                true,
+	"application/vnd.oci.image.index.v1+json":                   true,
+}
+
+type registryEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			MediaType  string `json:"mediaType"`
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// ParseRegistryNotification parses a CNCF distribution (registry:2) notification envelope
+// and returns a push for every tagged manifest push in it. Repositories are qualified
+// with the host the image was pushed to.
+func ParseRegistryNotification(body []byte) ([]*Push, error) {
+	var envelope registryEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid registry notification: %w", err)
+	}
+
+	pushes := []*Push{}
+	for _, event := range envelope.Events {
+		target := event.Target
+		if event.Action != "push" || target.Tag == "" || !manifestMediaTypes[target.MediaType] {
+			continue
+		}
+
+		host := event.Request.Host
+		if host == "" {
+			if u, err := url.Parse(target.URL); err == nil {
+				host = u.Host
+			}
+		}
+		if host == "" {
+			return nil, fmt.Errorf("registry notification for %s has no host", target.Repository)
+		}
+
+		push, err := newPush(host+"/"+target.Repository, target.Tag, target.Digest)
+		if err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, push)
+	}
+	return pushes, nil
+}
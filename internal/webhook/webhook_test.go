@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRegistryNotification(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Push
+	}{
+		{
+			file: "registry_push_tagged.json",
+			want: []Push{{
+				Repository: "registry.example.com:5000/acme/web",
+				Tag:        "1.4.2",
+				Digest:     "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+			}},
+		},
+		// Pushing a manifest by digest, e.g. the platform manifests of a multi-arch image,
+		// doesn't move a tag
+		{file: "registry_push_digest_only.json"},
+		{file: "registry_pull.json"},
+		// Layer and config blobs are pushed before the manifest
+		{file: "registry_push_blob.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pushes, err := ParseRegistryNotification(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pushes) != len(tt.want) {
+				t.Fatalf("got %d pushes, want %d: %+v", len(pushes), len(tt.want), pushes)
+			}
+			for i, push := range pushes {
+				if *push != tt.want[i] {
+					t.Errorf("push %d: got %+v, want %+v", i, *push, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRegistryNotificationHostFromURL(t *testing.T) {
+	body := []byte(`{"events": [{"action": "push", "target": {
+		"mediaType": "application/vnd.oci.image.index.v1+json",
+		"digest": "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+		"repository": "acme/web",
+		"url": "https://registry.example.com/v2/acme/web/manifests/sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+		"tag": "latest"}}]}`)
+
+	pushes, err := ParseRegistryNotification(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushes) != 1 || pushes[0].Repository != "registry.example.com/acme/web" {
+		t.Fatalf("got %+v, want one push for registry.example.com/acme/web", pushes)
+	}
+	if got, want := pushes[0].Image(), "registry.example.com/acme/web:latest@sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"; got != want {
+		t.Errorf("got image %q, want %q", got, want)
+	}
+}
+
+func TestParseRegistryNotificationInvalid(t *testing.T) {
+	if _, err := ParseRegistryNotification([]byte(`{"events": [`)); err == nil {
+		t.Error("expected error for truncated envelope")
+	}
+}
@@ -0,0 +1,180 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // the container image has no zoneinfo
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a daily time range on some weekdays. A range whose end is before its start,
+// such as 22:00-02:00, ends on the following day.
+type window struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+	loc   *time.Location
+}
+
+// Schedule is a set of maintenance windows, such as "Sat 02:00-04:00 UTC" or
+// "Mon-Fri 22:00-23:30 Europe/Berlin; Sun 00:00-06:00".
+type Schedule struct {
+	raw     string
+	windows []window
+}
+
+// Parse parses one or more windows separated by ";". Each window is a day list ("Sat",
+// "Sat,Sun", "Mon-Fri" or "*"), a time range and an optional time zone, UTC by default.
+func Parse(raw string) (*Schedule, error) {
+	schedule := &Schedule{raw: raw}
+	for part := range strings.SplitSeq(raw, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deploy window %q: %w", strings.TrimSpace(part), err)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+	if len(schedule.windows) == 0 {
+		return nil, fmt.Errorf("invalid deploy window %q: no windows", raw)
+	}
+	return schedule, nil
+}
+
+func parseWindow(raw string) (window, error) {
+	fields := strings.Fields(raw)
+	if len(fields) != 2 && len(fields) != 3 {
+		return window{}, fmt.Errorf("expected \"<days> <HH:MM>-<HH:MM> [zone]\"")
+	}
+
+	w := window{loc: time.UTC}
+	if err := w.parseDays(fields[0]); err != nil {
+		return window{}, err
+	}
+
+	from, to, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return window{}, fmt.Errorf("time range %q must look like 02:00-04:00", fields[1])
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return window{}, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return window{}, err
+	}
+	if w.start == w.end {
+		return window{}, fmt.Errorf("time range %q is empty", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if w.loc, err = time.LoadLocation(fields[2]); err != nil {
+			return window{}, fmt.Errorf("unknown time zone %q", fields[2])
+		}
+	}
+	return w, nil
+}
+
+func (w *window) parseDays(raw string) error {
+	if raw == "*" {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return nil
+	}
+	for item := range strings.SplitSeq(strings.ToLower(raw), ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from, ok := weekdays[first]
+		if !ok {
+			return fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[last]; !ok {
+				return fmt.Errorf("unknown day %q", last)
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon
+		for d := from; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(raw string) (int, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		if raw == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", raw)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w window) contains(t time.Time) bool {
+	local := t.In(w.loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+
+	if w.start < w.end {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	yesterday := (today + 6) % 7
+	return (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// nextOpen returns the first time at or after t at which the window opens.
+func (w window) nextOpen(t time.Time) time.Time {
+	local := t.In(w.loc)
+	for i := 0; i <= 7; i++ {
+		// Build the wall clock time directly, as days around DST changes aren't 24 hours
+		open := time.Date(local.Year(), local.Month(), local.Day()+i, w.start/60, w.start%60, 0, 0, w.loc)
+		if w.days[open.Weekday()] && !open.Before(t) {
+			return open
+		}
+	}
+	return time.Time{}
+}
+
+// Contains reports whether t falls inside one of the windows.
+func (s *Schedule) Contains(t time.Time) bool {
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns t if it is inside a window, or the time the next window opens.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Contains(t) {
+		return t
+	}
+	var next time.Time
+	for _, w := range s.windows {
+		if open := w.nextOpen(t); !open.IsZero() && (next.IsZero() || open.Before(next)) {
+			next = open
+		}
+	}
+	return next
+}
+
+func (s *Schedule) String() string {
+	return s.raw
+}
@@ -0,0 +1,59 @@
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		from     time.Time
+		want     time.Time
+	}{
+		{
+			name:     "clocks go forward",
+			schedule: "Sun 04:00-05:00 Europe/Berlin",
+			from:     time.Date(2026, time.March, 28, 12, 0, 0, 0, berlin),
+			want:     time.Date(2026, time.March, 29, 4, 0, 0, 0, berlin),
+		},
+		{
+			name:     "clocks go back",
+			schedule: "Sun 04:00-05:00 Europe/Berlin",
+			from:     time.Date(2026, time.October, 24, 12, 0, 0, 0, berlin),
+			want:     time.Date(2026, time.October, 25, 4, 0, 0, 0, berlin),
+		},
+		{
+			name:     "week after the change",
+			schedule: "Sat 22:00-23:00 Europe/Berlin",
+			from:     time.Date(2026, time.March, 28, 23, 30, 0, 0, berlin),
+			want:     time.Date(2026, time.April, 4, 22, 0, 0, 0, berlin),
+		},
+		{
+			name:     "inside window",
+			schedule: "Sun 04:00-05:00 Europe/Berlin",
+			from:     time.Date(2026, time.March, 29, 4, 30, 0, 0, berlin),
+			want:     time.Date(2026, time.March, 29, 4, 30, 0, 0, berlin),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if !schedule.Contains(tt.want) {
+				t.Errorf("%s is not inside %s", tt.want, tt.schedule)
+			}
+		})
+	}
+}
@@ -6,13 +6,19 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/alexraskin/swarmctl/internal/audit"
 	"github.com/alexraskin/swarmctl/internal/cloudflare"
 	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/history"
 	"github.com/alexraskin/swarmctl/internal/logger"
+	"github.com/alexraskin/swarmctl/internal/middle"
 	"github.com/alexraskin/swarmctl/internal/pushover"
+	"github.com/alexraskin/swarmctl/internal/queue"
+	"github.com/alexraskin/swarmctl/internal/registry"
 	"github.com/alexraskin/swarmctl/internal/ver"
 	"github.com/alexraskin/swarmctl/server"
 )
@@ -36,7 +42,13 @@ func main() {
 		panic(err)
 	}
 
-	dockerClient, err := docker.NewDockerClient()
+	registryAuths, err := registry.ParseAuths(config.RegistryAuth)
+	if err != nil {
+		logger.Error("failed to load registry auth", "error", err)
+		os.Exit(-1)
+	}
+
+	dockerClient, err := docker.NewDockerClient(registryAuths)
 	if err != nil {
 		logger.Error("failed to create docker client", "error", err)
 		os.Exit(-1)
@@ -50,8 +62,63 @@ func main() {
 
 	cfSyncer := cloudflare.NewSyncer(cloudflareClient)
 
+	tokens, err := middle.LoadTokenRegistry(config.AuthTokens, config.AuthToken)
+	if err != nil {
+		logger.Error("failed to load API tokens", "error", err)
+		os.Exit(-1)
+	}
+
+	authenticators := []middle.Authenticator{tokens}
+
+	if config.OIDCConfig != "" {
+		jwtConfig, err := middle.ParseJWTConfig(config.OIDCConfig)
+		if err != nil {
+			logger.Error("failed to load OIDC config", "error", err)
+			os.Exit(-1)
+		}
+		jwtAuth, err := middle.NewJWTAuthenticator(jwtConfig, logger)
+		if err != nil {
+			logger.Error("failed to create JWT authenticator", "error", err)
+			os.Exit(-1)
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+
+	if tokens.Len() == 0 && config.OIDCConfig == "" {
+		logger.Error("no authentication configured, set AUTH_TOKEN, AUTH_TOKENS or OIDC_CONFIG")
+		os.Exit(-1)
+	}
+
 	pushoverClient := pushover.NewPushoverClient(config.PushoverAPIKey)
 
+	auditLog, err := audit.Open(filepath.Join(config.DataDir, "audit.jsonl"))
+	if err != nil {
+		logger.Error("failed to open audit log", "error", err)
+		os.Exit(-1)
+	}
+	defer auditLog.Close()
+
+	deployHistory, err := history.Open(filepath.Join(config.DataDir, "history.jsonl"))
+	if err != nil {
+		logger.Error("failed to open deployment history", "error", err)
+		os.Exit(-1)
+	}
+	defer deployHistory.Close()
+
+	deployQueue, err := queue.Open(filepath.Join(config.DataDir, "queue.json"))
+	if err != nil {
+		logger.Error("failed to open deployment queue", "error", err)
+		os.Exit(-1)
+	}
+
+	approvals, err := queue.Open(filepath.Join(config.DataDir, "approvals.json"))
+	if err != nil {
+		logger.Error("failed to open pending deployments", "error", err)
+		os.Exit(-1)
+	}
+
+	registryClient := registry.NewClient(registryAuths)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -65,6 +132,12 @@ func main() {
 		logger,
 		cloudflareClient,
 		cfSyncer,
+		authenticators,
+		auditLog,
+		deployHistory,
+		registryClient,
+		deployQueue,
+		approvals,
 	)
 
 	go s.Start()
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/audit"
+	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/middle"
+	"github.com/alexraskin/swarmctl/internal/queue"
+)
+
+// requireApprovalLabel makes every update of a service wait for a second token to approve it.
+const requireApprovalLabel = "swarmctl.require-approval"
+
+// rejectedDeployment is an image digest an approver turned down for a service. The
+// auto-updater skips it rather than asking for approval again on every check.
+type rejectedDeployment struct {
+	service string
+	digest  string
+}
+
+func (s *Server) wasRejected(service, digest string) bool {
+	_, ok := s.rejected.Load(rejectedDeployment{service: service, digest: digest})
+	return ok
+}
+
+func requiresApproval(svc *swarm.Service) bool {
+	required, _ := strconv.ParseBool(svc.Spec.Labels[requireApprovalLabel])
+	return required
+}
+
+// gateDeployment holds back an update of svc to image that needs approval or falls
+// outside the service's deploy window, returning the pending or queued item. It returns
+// nil when the update may be applied right away.
+func (s *Server) gateDeployment(ctx context.Context, svc *swarm.Service, image, triggeredBy, requestID string) (*queue.Item, error) {
+	if requiresApproval(svc) {
+		// Pin the image, so approvers decide on exactly what will be deployed even if the
+		// tag is moved before they do
+		pinned, _, err := s.dockerClient.ResolveImageDigest(image, ctx)
+		if err != nil {
+			return nil, err
+		}
+		item, err := s.requestApproval(svc, pinned, triggeredBy, requestID)
+		return &item, err
+	}
+	return s.holdForWindow(svc, image, triggeredBy, requestID)
+}
+
+// refuseUnapproved rejects a change that can't be held for approval, such as a rollback
+// or a v2 spec update, when svc requires approval. It writes the response itself and
+// returns true if the change was refused.
+func (s *Server) refuseUnapproved(w http.ResponseWriter, r *http.Request, svc *swarm.Service) bool {
+	if !requiresApproval(svc) {
+		return false
+	}
+	s.logger.Warn("Change refused, service requires approval", "serviceName", svc.Spec.Name, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	http.Error(w, fmt.Sprintf("%s requires approval, deploy images through /v1/update/%s instead", svc.Spec.Name, svc.Spec.Name), http.StatusConflict)
+	return true
+}
+
+// holdForWindow queues an update of svc to image if its deploy window is closed.
+func (s *Server) holdForWindow(svc *swarm.Service, image, triggeredBy, requestID string) (*queue.Item, error) {
+	schedule, err := deployWindow(svc)
+	if err != nil || schedule == nil || schedule.Contains(time.Now()) {
+		return nil, err
+	}
+	item, err := s.queueDeployment(svc, schedule, image, triggeredBy, requestID)
+	return &item, err
+}
+
+// requestApproval creates a pending deployment and alerts approvers. Requesting the same
+// image again returns the deployment that is already pending without a new alert.
+func (s *Server) requestApproval(svc *swarm.Service, image, triggeredBy, requestID string) (queue.Item, error) {
+	for _, pending := range s.approvals.List() {
+		if pending.Service == svc.Spec.Name && pending.Image == image {
+			return pending, nil
+		}
+	}
+
+	item, replaced, err := s.approvals.Add(queue.Item{
+		Service:     svc.Spec.Name,
+		Image:       image,
+		TriggeredBy: triggeredBy,
+		RequestID:   requestID,
+		Reason:      "approval required",
+	})
+	if err != nil {
+		return queue.Item{}, err
+	}
+
+	for _, old := range replaced {
+		s.logger.Info("Pending deployment superseded", "id", old.ID, "serviceName", old.Service, "image", old.Image, "requestID", requestID)
+	}
+	s.logger.Info("Deployment awaiting approval", "id", item.ID, "serviceName", item.Service, "image", image, "triggeredBy", triggeredBy, "requestID", requestID)
+
+	s.notify("SWARMCTL APPROVAL REQUIRED", fmt.Sprintf("%s wants to deploy %s to %s. Approve with POST /v1/deployments/%s/approve", triggeredBy, image, item.Service, item.ID), item.CreatedAt)
+	return item, nil
+}
+
+func (s *Server) listDeployments(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.approvals.List())
+}
+
+func (s *Server) approveDeployment(w http.ResponseWriter, r *http.Request) {
+	item, svc := s.authorizeApproval(w, r)
+	if svc == nil {
+		return
+	}
+
+	approver := middle.TokenName(r.Context())
+	triggeredBy := fmt.Sprintf("%s, approved by %s", item.TriggeredBy, approver)
+	s.logger.Info("Deployment approved", "id", item.ID, "serviceName", item.Service, "image", item.Image, "approver", approver, "requestID", middleware.GetReqID(r.Context()))
+
+	held, err := s.holdForWindow(svc, item.Image, triggeredBy, item.RequestID)
+	if err != nil {
+		s.logger.Error("Error queueing deployment", "error", err, "serviceName", item.Service, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if held != nil {
+		writeJSON(w, http.StatusAccepted, held)
+		return
+	}
+
+	result := s.deployImage(s.ctx, item.Service, item.Image, triggeredBy, item.RequestID)
+	if !result.Success {
+		writeJSON(w, http.StatusInternalServerError, result)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) rejectDeployment(w http.ResponseWriter, r *http.Request) {
+	item, svc := s.authorizeApproval(w, r)
+	if svc == nil {
+		return
+	}
+
+	s.rejected.Store(rejectedDeployment{service: item.Service, digest: docker.ImageDigest(item.Image)}, time.Now())
+
+	s.logger.Info("Deployment rejected", "id", item.ID, "serviceName", item.Service, "image", item.Image, "approver", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	writeJSON(w, http.StatusOK, item)
+}
+
+// authorizeApproval checks the request's token may decide on the pending deployment and
+// claims it. On failure it writes the response itself and returns a nil service.
+func (s *Server) authorizeApproval(w http.ResponseWriter, r *http.Request) (queue.Item, *swarm.Service) {
+	id := chi.URLParam(r, "id")
+	item, ok := s.approvals.Get(id)
+	if !ok {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return queue.Item{}, nil
+	}
+
+	token, ok := middle.TokenFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return queue.Item{}, nil
+	}
+	if token.Name == item.TriggeredBy {
+		http.Error(w, "Forbidden: a deployment must be approved by a different token than the one that requested it", http.StatusForbidden)
+		return queue.Item{}, nil
+	}
+	if !token.AllowsService(item.Service) {
+		http.Error(w, fmt.Sprintf("Forbidden: token %q may not approve deployments of %s", token.Name, item.Service), http.StatusForbidden)
+		return queue.Item{}, nil
+	}
+
+	svc, err := s.dockerClient.GetDockerService(item.Service, r.Context())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			http.Error(w, "Service not found", http.StatusNotFound)
+			return queue.Item{}, nil
+		}
+		s.logger.Error("Error getting service", "error", err, "serviceName", item.Service, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return queue.Item{}, nil
+	}
+
+	auditService(r, svc)
+	if entry := audit.FromContext(r.Context()); entry != nil {
+		entry.NewImage = item.Image
+	}
+
+	// Removing the item claims it, so concurrent decisions can't both act on it
+	if _, ok, err := s.approvals.Remove(id); err != nil || !ok {
+		if err != nil {
+			s.logger.Error("Failed to remove pending deployment", "id", id, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return queue.Item{}, nil
+		}
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return queue.Item{}, nil
+	}
+
+	return item, svc
+}
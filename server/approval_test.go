@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/alexraskin/swarmctl/internal/audit"
+	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/middle"
+	"github.com/alexraskin/swarmctl/internal/pushover"
+	"github.com/alexraskin/swarmctl/internal/queue"
+	"github.com/alexraskin/swarmctl/internal/ver"
+)
+
+const (
+	testToken     = "test-token"
+	approverToken = "approver-token"
+)
+
+// fakeDocker serves just enough of the Docker Engine API to inspect services and resolve
+// tags. Log requests always fail. Any request that would change a service is recorded so
+// tests can assert none was made.
+type fakeDocker struct {
+	services map[string]swarm.Service
+
+	mu      sync.Mutex
+	tags    map[string]string // image -> digest it currently points to
+	changes []string
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/_ping") {
+		w.Header().Set("API-Version", "1.47")
+		w.Write([]byte("OK"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		f.mu.Lock()
+		f.changes = append(f.changes, r.Method+" "+r.URL.Path)
+		f.mu.Unlock()
+		http.Error(w, `{"message":"not implemented"}`, http.StatusNotImplemented)
+		return
+	}
+
+	if _, image, ok := strings.Cut(r.URL.Path, "/distribution/"); ok {
+		f.mu.Lock()
+		digest, found := f.tags[strings.TrimSuffix(image, "/json")]
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"manifest unknown"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"Descriptor": {"mediaType": "application/vnd.oci.image.index.v1+json", "digest": %q, "size": 1024}}`, digest)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/logs") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"logs unavailable"}`))
+		return
+	}
+
+	_, name, ok := strings.Cut(r.URL.Path, "/services/")
+	svc, found := f.services[name]
+	if !ok || !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"service not found"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(svc)
+}
+
+// Tag points image at digest, as a push to the registry would.
+func (f *fakeDocker) Tag(image, digest string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tags[image] = digest
+}
+
+func (f *fakeDocker) Changes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.changes...)
+}
+
+func newTestServer(t *testing.T, services ...swarm.Service) (*Server, *fakeDocker) {
+	t.Helper()
+
+	fake := &fakeDocker{services: map[string]swarm.Service{}, tags: map[string]string{}}
+	for _, svc := range services {
+		fake.services[svc.Spec.Name] = svc
+	}
+	engine := httptest.NewServer(fake)
+	t.Cleanup(engine.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+engine.Listener.Addr().String())
+
+	dockerClient, err := docker.NewDockerClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approverHash := sha256.Sum256([]byte(approverToken))
+	tokens, err := middle.LoadTokenRegistry(`{"tokens": [{"name": "approver", "hash": "sha256:`+hex.EncodeToString(approverHash[:])+`", "scopes": ["approve"]}]}`, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+	deployQueue, err := queue.Open(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvals, err := queue.Open(filepath.Join(dir, "approvals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty Pushover key fails validation before anything is sent
+	s := NewServer(context.Background(), ver.Version{}, &Config{}, "0", dockerClient, pushover.NewPushoverClient(""),
+		slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil,
+		[]middle.Authenticator{tokens}, auditLog, nil, nil, deployQueue, approvals)
+	return s, fake
+}
+
+func testService(name string, labels map[string]string) swarm.Service {
+	svc := swarm.Service{ID: name + "-id"}
+	svc.Spec.Name = name
+	svc.Spec.Labels = labels
+	svc.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: "ghcr.io/acme/" + name + ":1.0.0"}
+
+	previous := svc.Spec
+	previous.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: "ghcr.io/acme/" + name + ":0.9.0"}
+	svc.PreviousSpec = &previous
+	return svc
+}
+
+func doRequest(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	return doRequestAs(s, testToken, method, target, body)
+}
+
+func doRequestAs(s *Server, token, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProtectedServiceRefusesUngatedChanges(t *testing.T) {
+	s, fake := newTestServer(t, testService("web", map[string]string{requireApprovalLabel: "true"}))
+
+	tests := []struct {
+		name, method, target, body string
+	}{
+		{"v2 image update", http.MethodPost, "/v2/services/web/update", `{"image": "ghcr.io/acme/web:2.0.0"}`},
+		{"v2 force redeploy", http.MethodPost, "/v2/services/web/update", `{"force": true}`},
+		{"rollback", http.MethodPost, "/v1/rollback/web", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(s, tt.method, tt.target, tt.body)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+			}
+		})
+	}
+
+	if changes := fake.Changes(); len(changes) > 0 {
+		t.Errorf("protected service was changed: %v", changes)
+	}
+	if pending := s.approvals.List(); len(pending) != 0 {
+		t.Errorf("refused changes created pending deployments: %+v", pending)
+	}
+}
+
+const (
+	testDigest  = "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"
+	movedDigest = "sha256:3b1e4c2f4b0a2d2b5c9c7e0f1f6a8f6e1d5c2b9a8e7f6d5c4b3a2f1e0d9c8b7a"
+)
+
+func TestProtectedServiceUpdateAwaitsApproval(t *testing.T) {
+	s, fake := newTestServer(t, testService("web", map[string]string{requireApprovalLabel: "true"}))
+	fake.Tag("ghcr.io/acme/web:2.0.0", testDigest)
+
+	rec := doRequest(s, http.MethodPost, "/v1/update/web?image=ghcr.io/acme/web:2.0.0", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	if changes := fake.Changes(); len(changes) > 0 {
+		t.Errorf("service was changed before approval: %v", changes)
+	}
+
+	// Moving the tag afterwards must not change what the approver signs off on
+	fake.Tag("ghcr.io/acme/web:2.0.0", movedDigest)
+	want := "ghcr.io/acme/web:2.0.0@" + testDigest
+	if pending := s.approvals.List(); len(pending) != 1 || pending[0].Image != want {
+		t.Errorf("got pending deployments %+v, want one for %s", pending, want)
+	}
+}
+
+func TestProtectedServiceUpdateNeedsResolvableImage(t *testing.T) {
+	s, _ := newTestServer(t, testService("web", map[string]string{requireApprovalLabel: "true"}))
+
+	rec := doRequest(s, http.MethodPost, "/v1/update/web?image=ghcr.io/acme/web:missing", "")
+	if rec.Code == http.StatusAccepted {
+		t.Fatalf("got status %d for an image that can't be pinned", rec.Code)
+	}
+	if pending := s.approvals.List(); len(pending) != 0 {
+		t.Errorf("got pending deployments %+v, want none", pending)
+	}
+}
+
+func TestRejectedDigestIsRemembered(t *testing.T) {
+	s, fake := newTestServer(t, testService("web", map[string]string{requireApprovalLabel: "true"}))
+	fake.Tag("ghcr.io/acme/web:2.0.0", testDigest)
+
+	rec := doRequest(s, http.MethodPost, "/v1/update/web?image=ghcr.io/acme/web:2.0.0", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	pending := s.approvals.List()
+	if len(pending) != 1 {
+		t.Fatalf("got %d pending deployments, want 1", len(pending))
+	}
+
+	rec = doRequestAs(s, approverToken, http.MethodPost, "/v1/deployments/"+pending[0].ID+"/reject", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !s.wasRejected("web", testDigest) {
+		t.Error("rejected digest was not remembered")
+	}
+	if s.wasRejected("web", movedDigest) {
+		t.Error("other digests must not count as rejected")
+	}
+}
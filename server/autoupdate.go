@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/alexraskin/swarmctl/internal/docker"
+)
+
+const (
+	autoUpdateLabel         = "swarmctl.autoupdate"
+	autoUpdateIntervalLabel = "swarmctl.autoupdate.interval"
+	autoUpdateTick          = 1 * time.Minute
+	minAutoUpdateInterval   = 1 * time.Minute
+)
+
+// startAutoUpdater polls the registry for services labelled swarmctl.autoupdate=true and
+// redeploys them when the digest behind their tag changes.
+func (s *Server) startAutoUpdater() {
+	ticker := time.NewTicker(autoUpdateTick)
+	defer ticker.Stop()
+
+	s.logger.Debug("Starting auto-updater")
+
+	// lastChecked is only touched by this goroutine
+	lastChecked := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-ticker.C:
+			services, err := s.dockerClient.GetDockerServices(s.ctx)
+			if err != nil {
+				s.logger.Error("Auto-update failed to list services", "error", err)
+				continue
+			}
+
+			now := time.Now()
+			seen := make(map[string]bool, len(services))
+			for _, svc := range services {
+				enabled, _ := strconv.ParseBool(svc.Spec.Labels[autoUpdateLabel])
+				if !enabled || svc.Spec.TaskTemplate.ContainerSpec == nil {
+					continue
+				}
+
+				name := svc.Spec.Name
+				seen[name] = true
+				if now.Sub(lastChecked[name]) < s.autoUpdateInterval(svc) {
+					continue
+				}
+				lastChecked[name] = now
+
+				s.checkForUpdate(svc)
+			}
+
+			for name := range lastChecked {
+				if !seen[name] {
+					delete(lastChecked, name)
+				}
+			}
+
+		case <-s.ctx.Done():
+			s.logger.Debug("Stopping auto-updater")
+			return
+		}
+	}
+}
+
+// autoUpdateInterval returns how often a service should be checked, from its
+// swarmctl.autoupdate.interval label or the configured default.
+func (s *Server) autoUpdateInterval(svc swarm.Service) time.Duration {
+	interval := time.Duration(s.config.AutoUpdateIntervalMinutes) * time.Minute
+
+	raw := svc.Spec.Labels[autoUpdateIntervalLabel]
+	if raw == "" {
+		return interval
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		s.logger.Warn("Invalid auto-update interval label", slog.String("service", svc.Spec.Name), slog.String("interval", raw), "error", err)
+		return interval
+	}
+	return max(parsed, minAutoUpdateInterval)
+}
+
+// checkForUpdate resolves the service's tag in the registry and redeploys it when the
+// digest differs from the one it runs.
+func (s *Server) checkForUpdate(svc swarm.Service) {
+	name := svc.Spec.Name
+	current := svc.Spec.TaskTemplate.ContainerSpec.Image
+
+	tag, err := imageTagOf(current)
+	if err != nil {
+		s.logger.Warn("Skipping auto-update", slog.String("service", name), "error", err)
+		return
+	}
+
+	// Wait for the window rather than queueing, the next check will find the newest image
+	schedule, err := deployWindow(&svc)
+	if err != nil {
+		s.logger.Warn("Skipping auto-update", slog.String("service", name), "error", err)
+		return
+	}
+	if schedule != nil && !schedule.Contains(time.Now()) {
+		s.logger.Debug("Outside deploy window", slog.String("service", name), slog.String("window", schedule.String()))
+		return
+	}
+
+	// With a policy the service may move to a newer tag, otherwise only its tag is re-pulled
+	target := tag
+	policy, err := updatePolicy(&svc)
+	if err != nil {
+		s.logger.Warn("Skipping auto-update", slog.String("service", name), "error", err)
+		return
+	}
+	if policy != nil {
+		if target, err = s.latestAllowedImage(s.ctx, policy, tag); err != nil {
+			s.logger.Error("Auto-update failed to find newer tags", slog.String("service", name), slog.String("image", tag), "error", err)
+			return
+		}
+	}
+
+	pinned, digest, err := s.dockerClient.ResolveImageDigest(target, s.ctx)
+	if err != nil {
+		s.logger.Error("Auto-update failed to resolve digest", slog.String("service", name), slog.String("image", target), "error", err)
+		return
+	}
+	if target == tag && digest == docker.ImageDigest(current) {
+		s.logger.Debug("Service is up to date", slog.String("service", name), slog.String("digest", digest))
+		return
+	}
+
+	if s.wasRejected(name, digest) {
+		s.logger.Debug("Skipping rejected image", slog.String("service", name), slog.String("image", target), slog.String("digest", digest))
+		return
+	}
+
+	s.logger.Info("New image available", slog.String("service", name), slog.String("image", target), slog.String("digest", digest))
+
+	held, err := s.gateDeployment(s.ctx, &svc, pinned, "autoupdate", "")
+	if err != nil {
+		s.logger.Error("Auto-update failed to request approval", slog.String("service", name), "error", err)
+		return
+	}
+	if held != nil {
+		return
+	}
+
+	result := s.deployImage(s.ctx, name, pinned, "autoupdate", "")
+	if !result.Success {
+		s.notify("SWARMCTL AUTO-UPDATE FAILED", fmt.Sprintf("Failed to update %s to %s: %s", name, target, result.Error), time.Now())
+		return
+	}
+	s.notify("SWARMCTL AUTO-UPDATE", fmt.Sprintf("Updated %s to %s (%s)", name, target, digest), time.Now())
+}
+
+// imageTagOf strips the digest from an image reference, keeping its tag so the registry
+// can be asked what the tag currently points to.
+func imageTagOf(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", image, err)
+	}
+	trimmed := reference.TrimNamed(named)
+
+	if tagged, ok := named.(reference.Tagged); ok {
+		withTag, err := reference.WithTag(trimmed, tagged.Tag())
+		if err != nil {
+			return "", err
+		}
+		return reference.FamiliarString(withTag), nil
+	}
+	if _, ok := named.(reference.Canonical); ok {
+		return "", fmt.Errorf("image %s is pinned to a digest without a tag", image)
+	}
+	return reference.FamiliarString(reference.TagNameOnly(trimmed)), nil
+}
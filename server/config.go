@@ -11,6 +11,8 @@ import (
 
 type Config struct {
 	AuthToken                  string
+	AuthTokens                 string
+	OIDCConfig                 string
 	CloudflareTunnelID         string
 	CloudflareAPIKey           string
 	CloudflareAPIEmail         string
@@ -19,8 +21,14 @@ type Config struct {
 	PushoverRecipient          string
 	Environment                string
 	WebhookURL                 string
+	RegistryAuth               string
 	ServiceRemovalDelayMinutes int
 	DeleteDNSOnRemoval         bool
+	DataDir                    string
+	DockerHubWebhookSecret     string
+	GitHubWebhookSecret        string
+	RegistryWebhookSecret      string
+	AutoUpdateIntervalMinutes  int
 }
 
 func LoadConfig() *Config {
@@ -43,8 +51,24 @@ func LoadConfig() *Config {
 		deleteDNS = strings.ToLower(dnsStr) == "true"
 	}
 
+	// Default to ./data if not set
+	dataDir := "data"
+	if dirStr := os.Getenv("DATA_DIR"); dirStr != "" {
+		dataDir = dirStr
+	}
+
+	// Default to 15 minutes if not set
+	autoUpdateInterval := 15
+	if intervalStr := os.Getenv("AUTOUPDATE_INTERVAL_MINUTES"); intervalStr != "" {
+		if parsed, err := strconv.Atoi(intervalStr); err == nil && parsed > 0 {
+			autoUpdateInterval = parsed
+		}
+	}
+
 	return &Config{
-		AuthToken:                  getSecretOrEnv("AUTH_TOKEN"),
+		AuthToken:                  getOptionalSecretOrEnv("AUTH_TOKEN"),
+		AuthTokens:                 getOptionalSecretOrEnv("AUTH_TOKENS"),
+		OIDCConfig:                 getOptionalSecretOrEnv("OIDC_CONFIG"),
 		CloudflareTunnelID:         getSecretOrEnv("CLOUDFLARE_TUNNEL_ID"),
 		CloudflareAPIKey:           getSecretOrEnv("CLOUDFLARE_API_KEY"),
 		CloudflareAPIEmail:         getSecretOrEnv("CLOUDFLARE_API_EMAIL"),
@@ -53,8 +77,14 @@ func LoadConfig() *Config {
 		PushoverRecipient:          getSecretOrEnv("PUSHOVER_RECIPIENT"),
 		Environment:                getSecretOrEnv("ENVIROMENT"),
 		WebhookURL:                 getSecretOrEnv("WEBHOOK_URL"),
+		RegistryAuth:               getOptionalSecretOrEnv("REGISTRY_AUTH"),
 		ServiceRemovalDelayMinutes: removalDelay,
 		DeleteDNSOnRemoval:         deleteDNS,
+		DataDir:                    dataDir,
+		DockerHubWebhookSecret:     getOptionalSecretOrEnv("DOCKERHUB_WEBHOOK_SECRET"),
+		GitHubWebhookSecret:        getOptionalSecretOrEnv("GITHUB_WEBHOOK_SECRET"),
+		RegistryWebhookSecret:      getOptionalSecretOrEnv("REGISTRY_WEBHOOK_SECRET"),
+		AutoUpdateIntervalMinutes:  autoUpdateInterval,
 	}
 }
 
@@ -78,3 +108,12 @@ func getSecretOrEnv(key string) string {
 
 	return value
 }
+
+// getOptionalSecretOrEnv behaves like getSecretOrEnv but returns an empty string
+// instead of exiting when the variable is not set.
+func getOptionalSecretOrEnv(key string) string {
+	if os.Getenv(key) == "" {
+		return ""
+	}
+	return getSecretOrEnv(key)
+}
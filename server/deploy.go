@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/metrics"
+	"github.com/alexraskin/swarmctl/internal/queue"
+	"github.com/alexraskin/swarmctl/internal/webhook"
+)
+
+// autodeployLabel opts a service into deploys triggered by registry notifications.
+const autodeployLabel = "swarmctl.autodeploy"
+
+// deployResult is the outcome of an automated deployment to one service.
+type deployResult struct {
+	Service  string                       `json:"service"`
+	Image    string                       `json:"image"`
+	Success  bool                         `json:"success"`
+	Error    string                       `json:"error,omitempty"`
+	Response *docker.DockerUpdateResponse `json:"response,omitempty"`
+	Queued   *queue.Item                  `json:"queued,omitempty"` // held for approval or a deploy window
+}
+
+// deployImage updates a service to image on behalf of an automated trigger, such as a
+// registry webhook, and records the result in metrics and the deployment history.
+func (s *Server) deployImage(ctx context.Context, serviceName, image, triggeredBy, requestID string) deployResult {
+	result := deployResult{Service: serviceName, Image: image}
+
+	start := time.Now()
+	response, err := s.dockerClient.UpdateDockerService(serviceName, image, ctx)
+	duration := time.Since(start).Seconds()
+
+	if err != nil {
+		metrics.RecordDockerServiceUpdate(serviceName, "error", duration)
+		s.logger.Error("Error updating service", "error", err, "serviceName", serviceName, "image", image, "triggeredBy", triggeredBy, "requestID", requestID)
+		result.Error = err.Error()
+		return result
+	}
+
+	metrics.RecordDockerServiceUpdate(serviceName, "success", duration)
+	s.recordDeployment(serviceName, "update", triggeredBy, requestID, response)
+	s.logger.Info("Service updated", "serviceName", serviceName, "image", image, "triggeredBy", triggeredBy, "requestID", requestID)
+
+	result.Success = true
+	result.Response = response
+	return result
+}
+
+// deployPush redeploys every service running the pushed repository and tag. When
+// autodeployOnly is set, only services labelled swarmctl.autodeploy=true are considered.
+func (s *Server) deployPush(ctx context.Context, push *webhook.Push, autodeployOnly bool, triggeredBy, requestID string) ([]deployResult, error) {
+	services, err := s.dockerClient.GetDockerServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []deployResult{}
+	for _, svc := range services {
+		cs := svc.Spec.TaskTemplate.ContainerSpec
+		if cs == nil || !push.Matches(cs.Image) {
+			continue
+		}
+		if autodeployOnly && !autodeployEnabled(svc) {
+			continue
+		}
+
+		// Nothing to do if the service already runs the pushed digest
+		if push.Digest != "" && docker.ImageDigest(cs.Image) == push.Digest {
+			s.logger.Debug("Service already runs pushed digest", slog.String("service", svc.Spec.Name), slog.String("digest", push.Digest))
+			continue
+		}
+
+		held, err := s.gateDeployment(ctx, &svc, push.Image(), triggeredBy, requestID)
+		if err != nil {
+			results = append(results, deployResult{Service: svc.Spec.Name, Image: push.Image(), Error: err.Error()})
+			continue
+		}
+		if held != nil {
+			results = append(results, deployResult{Service: svc.Spec.Name, Image: push.Image(), Queued: held})
+			continue
+		}
+
+		results = append(results, s.deployImage(ctx, svc.Spec.Name, push.Image(), triggeredBy, requestID))
+	}
+	return results, nil
+}
+
+func autodeployEnabled(service swarm.Service) bool {
+	enabled, _ := strconv.ParseBool(service.Spec.Labels[autodeployLabel])
+	return enabled
+}
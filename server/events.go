@@ -0,0 +1,61 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	eventBufferSize   = 64
+	eventKeepAlive    = 30 * time.Second
+	stackNamespaceKey = "com.docker.stack.namespace"
+)
+
+// swarmEvent is the enriched form of a Docker event published on /v1/events.
+type swarmEvent struct {
+	Type      string    `json:"type"`
+	Action    string    `json:"action"`
+	Service   string    `json:"service"`
+	Stack     string    `json:"stack,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Container string    `json:"container,omitempty"`
+	ExitCode  string    `json:"exitCode,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// eventHub fans out swarm events to SSE subscribers. Slow subscribers miss events
+// rather than holding up the Docker event monitors.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan swarmEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan swarmEvent]struct{})}
+}
+
+func (h *eventHub) Subscribe() (<-chan swarmEvent, func()) {
+	ch := make(chan swarmEvent, eventBufferSize)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+func (h *eventHub) Publish(e swarmEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/history"
+)
+
+const (
+	ociRevisionLabel  = "org.opencontainers.image.revision"
+	ociSourceLabel    = "org.opencontainers.image.source"
+	imageLabelTimeout = 30 * time.Second
+)
+
+// recordDeployment adds a successful update or rollback to the service's history. The
+// image's OCI labels are looked up in the background since the registry can be slow;
+// Shutdown waits for these writes.
+func (s *Server) recordDeployment(serviceName, action, triggeredBy, requestID string, response *docker.DockerUpdateResponse) {
+	deployment := history.Deployment{
+		Time:        time.Now(),
+		Service:     serviceName,
+		Action:      action,
+		Image:       response.Image,
+		Digest:      response.NewDigest,
+		OldVersion:  response.OldVersion,
+		NewVersion:  response.NewVersion,
+		TriggeredBy: triggeredBy,
+		RequestID:   requestID,
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	// Once shutting down, skip the labels rather than start a write Shutdown won't wait for
+	if s.historyDraining {
+		s.appendDeployment(deployment)
+		return
+	}
+
+	s.historyWrites.Add(1)
+	go func() {
+		defer s.historyWrites.Done()
+
+		ctx, cancel := context.WithTimeout(s.ctx, imageLabelTimeout)
+		defer cancel()
+
+		config, err := s.registryClient.GetImageConfig(ctx, deployment.Image)
+		if err != nil {
+			s.logger.Debug("Could not read image labels", slog.String("image", deployment.Image), "error", err)
+		} else {
+			deployment.Revision = config.Labels[ociRevisionLabel]
+			deployment.Source = config.Labels[ociSourceLabel]
+		}
+		s.appendDeployment(deployment)
+	}()
+}
+
+func (s *Server) appendDeployment(deployment history.Deployment) {
+	if err := s.history.Append(deployment); err != nil {
+		s.logger.Error("Failed to record deployment", slog.String("service", deployment.Service), "error", err)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/audit"
+	"github.com/alexraskin/swarmctl/internal/webhook"
+)
+
+func (s *Server) dockerHubHook(w http.ResponseWriter, r *http.Request) {
+	if s.config.DockerHubWebhookSecret == "" {
+		s.notFound(w, r)
+		return
+	}
+	// Docker Hub can't sign its webhooks, so the secret is part of the configured URL
+	if !webhook.VerifySecret(s.config.DockerHubWebhookSecret, r.URL.Query().Get("token")) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	push, err := webhook.ParseDockerHub(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.handlePushes(w, r, []*webhook.Push{push}, false, "webhook:dockerhub")
+}
+
+func (s *Server) githubPackagesHook(w http.ResponseWriter, r *http.Request) {
+	if s.config.GitHubWebhookSecret == "" {
+		s.notFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !webhook.VerifyGitHubSignature(s.config.GitHubWebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	push, err := webhook.ParseGitHubPackage(r.Header.Get("X-GitHub-Event"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if push == nil {
+		// Pings and non-container events are acknowledged and ignored
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.handlePushes(w, r, []*webhook.Push{push}, false, "webhook:github-packages")
+}
+
+func (s *Server) registryHook(w http.ResponseWriter, r *http.Request) {
+	if s.config.RegistryWebhookSecret == "" {
+		s.notFound(w, r)
+		return
+	}
+	// The registry sends the secret as a static header from its notification endpoint config
+	secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !webhook.VerifySecret(s.config.RegistryWebhookSecret, secret) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pushes, err := webhook.ParseRegistryNotification(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(pushes) == 0 {
+		// Pulls, deletes and blob pushes are acknowledged and ignored
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.handlePushes(w, r, pushes, true, "webhook:registry")
+}
+
+func (s *Server) handlePushes(w http.ResponseWriter, r *http.Request, pushes []*webhook.Push, autodeployOnly bool, triggeredBy string) {
+	requestID := middleware.GetReqID(r.Context())
+
+	images := make([]string, len(pushes))
+	for i, push := range pushes {
+		images[i] = push.Image()
+	}
+	if entry := audit.FromContext(r.Context()); entry != nil {
+		entry.Token = triggeredBy
+		entry.NewImage = strings.Join(images, ",")
+	}
+
+	results := []deployResult{}
+	for _, push := range pushes {
+		s.logger.Info("Received image push", "image", push.Image(), "digest", push.Digest, "triggeredBy", triggeredBy, "requestID", requestID)
+
+		// Deploy even if the registry hangs up on us
+		pushResults, err := s.deployPush(s.ctx, push, autodeployOnly, triggeredBy, requestID)
+		if err != nil {
+			s.logger.Error("Error handling image push", "error", err, "image", push.Image(), "requestID", requestID)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, pushResults...)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type serviceSummary struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Image           string     `json:"image"`
+	Mode            string     `json:"mode"`
+	DesiredReplicas uint64     `json:"desiredReplicas"`
+	RunningReplicas uint64     `json:"runningReplicas"`
+	UpdateState     string     `json:"updateState,omitempty"`
+	UpdateMessage   string     `json:"updateMessage,omitempty"`
+	Hostnames       []string   `json:"hostnames"`
+	Version         uint64     `json:"version"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	LastUpdateAt    *time.Time `json:"lastUpdateAt,omitempty"`
+}
+
+func (s *Server) newServiceSummary(svc swarm.Service) serviceSummary {
+	summary := serviceSummary{
+		ID:        svc.ID,
+		Name:      svc.Spec.Name,
+		Mode:      serviceMode(svc.Spec.Mode),
+		Hostnames: []string{},
+		Version:   svc.Version.Index,
+		CreatedAt: svc.CreatedAt,
+		UpdatedAt: svc.UpdatedAt,
+	}
+
+	if svc.Spec.TaskTemplate.ContainerSpec != nil {
+		summary.Image = svc.Spec.TaskTemplate.ContainerSpec.Image
+	}
+
+	if svc.ServiceStatus != nil {
+		summary.DesiredReplicas = svc.ServiceStatus.DesiredTasks
+		summary.RunningReplicas = svc.ServiceStatus.RunningTasks
+	} else if svc.Spec.Mode.Replicated != nil && svc.Spec.Mode.Replicated.Replicas != nil {
+		summary.DesiredReplicas = *svc.Spec.Mode.Replicated.Replicas
+	}
+
+	if us := svc.UpdateStatus; us != nil {
+		summary.UpdateState = string(us.State)
+		summary.UpdateMessage = us.Message
+		summary.LastUpdateAt = us.StartedAt
+		if us.CompletedAt != nil {
+			summary.LastUpdateAt = us.CompletedAt
+		}
+	}
+
+	if svc.Spec.Labels["cloudflared.tunnel.enabled"] == "true" {
+		summary.Hostnames = s.extractHostnames(svc.Spec.Labels)
+	}
+
+	return summary
+}
+
+func serviceMode(mode swarm.ServiceMode) string {
+	switch {
+	case mode.Replicated != nil:
+		return "replicated"
+	case mode.Global != nil:
+		return "global"
+	case mode.ReplicatedJob != nil:
+		return "replicated-job"
+	case mode.GlobalJob != nil:
+		return "global-job"
+	}
+	return "unknown"
+}
+
+type taskSummary struct {
+	ID           string    `json:"id"`
+	Slot         int       `json:"slot,omitempty"`
+	NodeID       string    `json:"nodeId"`
+	Node         string    `json:"node,omitempty"`
+	Image        string    `json:"image"`
+	DesiredState string    `json:"desiredState"`
+	CurrentState string    `json:"currentState"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ExitCode     *int      `json:"exitCode,omitempty"`
+	ContainerID  string    `json:"containerId,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func newTaskSummary(task swarm.Task, nodeNames map[string]string) taskSummary {
+	summary := taskSummary{
+		ID:           task.ID,
+		Slot:         task.Slot,
+		NodeID:       task.NodeID,
+		Node:         nodeNames[task.NodeID],
+		DesiredState: string(task.DesiredState),
+		CurrentState: string(task.Status.State),
+		Message:      task.Status.Message,
+		Error:        task.Status.Err,
+		UpdatedAt:    task.Status.Timestamp,
+	}
+
+	if task.Spec.ContainerSpec != nil {
+		summary.Image = task.Spec.ContainerSpec.Image
+	}
+
+	if cs := task.Status.ContainerStatus; cs != nil {
+		summary.ContainerID = cs.ContainerID
+		// Exit codes are only meaningful once the container has stopped
+		if task.Status.State != swarm.TaskStateRunning {
+			exitCode := cs.ExitCode
+			summary.ExitCode = &exitCode
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/middle"
+)
+
+// allowTokensLabel lists the token names or groups allowed to deploy a service.
+// Services without it can be deployed by any token with the update scope.
+const allowTokensLabel = "swarmctl.allow-tokens"
+
+// authorizeServiceUpdate resolves the service and checks the request's token may deploy it.
+// On failure it writes the response itself and returns nil.
+func (s *Server) authorizeServiceUpdate(w http.ResponseWriter, r *http.Request, serviceName string) *swarm.Service {
+	svc, err := s.dockerClient.GetDockerService(serviceName, r.Context())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			http.Error(w, "Service not found", http.StatusNotFound)
+			return nil
+		}
+		s.logger.Error("Error getting service", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	if err := checkServicePermission(r, svc); err != nil {
+		s.logger.Warn("Service update denied", "error", err, "serviceName", serviceName, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return nil
+	}
+
+	return svc
+}
+
+func checkServicePermission(r *http.Request, svc *swarm.Service) error {
+	token, ok := middle.TokenFromContext(r.Context())
+	if !ok {
+		return fmt.Errorf("request is not authenticated")
+	}
+
+	if !token.AllowsService(svc.Spec.Name) {
+		return fmt.Errorf("token %q may only deploy services matching %s", token.Name, strings.Join(token.Services, ","))
+	}
+
+	allowed := parseAllowList(svc.Spec.Labels[allowTokensLabel])
+	if len(allowed) == 0 || token.HasScope(middle.ScopeAdmin) || token.MatchesAny(allowed) {
+		return nil
+	}
+	return fmt.Errorf("token %q is not allowed to deploy service %s (%s=%s)", token.Name, svc.Spec.Name, allowTokensLabel, svc.Spec.Labels[allowTokensLabel])
+}
+
+func parseAllowList(value string) []string {
+	names := []string{}
+	for name := range strings.SplitSeq(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/alexraskin/swarmctl/internal/semver"
+)
+
+const autoUpdatePolicyLabel = "swarmctl.autoupdate.policy"
+
+// updatePolicy returns the policy from the service's swarmctl.autoupdate.policy label,
+// or nil if it has none.
+func updatePolicy(svc *swarm.Service) (*semver.Policy, error) {
+	raw := svc.Spec.Labels[autoUpdatePolicyLabel]
+	if raw == "" {
+		return nil, nil
+	}
+	policy, err := semver.ParsePolicy(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// checkUpdatePolicy returns an error if moving the service to image would violate its
+// update policy. Switching a service with a policy to another repository is a violation
+// too, since its tags are not versions of the same thing.
+func checkUpdatePolicy(svc *swarm.Service, image string) error {
+	policy, err := updatePolicy(svc)
+	if err != nil || policy == nil || svc.Spec.TaskTemplate.ContainerSpec == nil {
+		return err
+	}
+
+	currentName, currentTag, err := splitImageTag(svc.Spec.TaskTemplate.ContainerSpec.Image)
+	if err != nil {
+		return err
+	}
+	name, tag, err := splitImageTag(image)
+	if err != nil {
+		return err
+	}
+	if name.Name() != currentName.Name() {
+		return fmt.Errorf("update policy %s of service %s does not allow switching from %s to %s", policy, svc.Spec.Name, reference.FamiliarName(currentName), reference.FamiliarName(name))
+	}
+
+	current, err := semver.Parse(currentTag)
+	if err != nil {
+		return fmt.Errorf("update policy %s can't be applied: running %w", policy, err)
+	}
+	candidate, err := semver.Parse(tag)
+	if err != nil {
+		return fmt.Errorf("update policy %s only allows version tags: %w", policy, err)
+	}
+	if !policy.Allows(current, candidate) {
+		return fmt.Errorf("tag %s is not allowed by update policy %s of service %s (running %s)", tag, policy, svc.Spec.Name, currentTag)
+	}
+	return nil
+}
+
+// latestAllowedImage lists the tags of the service's repository and returns the image
+// with the highest tag its policy allows, or image itself when nothing newer is allowed.
+func (s *Server) latestAllowedImage(ctx context.Context, policy *semver.Policy, image string) (string, error) {
+	name, tag, err := splitImageTag(image)
+	if err != nil {
+		return "", err
+	}
+	current, err := semver.Parse(tag)
+	if err != nil {
+		return "", fmt.Errorf("update policy %s can't be applied: running %w", policy, err)
+	}
+
+	tags, err := s.registryClient.ListTags(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	latest, ok := policy.Latest(current, tags)
+	if !ok {
+		return image, nil
+	}
+	tagged, err := reference.WithTag(name, latest)
+	if err != nil {
+		return "", err
+	}
+	return reference.FamiliarString(tagged), nil
+}
+
+// splitImageTag returns the repository of image and its tag, which defaults to latest.
+func splitImageTag(image string) (reference.Named, string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid image reference %q: %w", image, err)
+	}
+	tag := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+	return reference.TrimNamed(named), tag, nil
+}
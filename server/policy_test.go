@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckUpdatePolicy(t *testing.T) {
+	svc := testService("web", map[string]string{autoUpdatePolicyLabel: "minor"})
+
+	tests := []struct {
+		image   string
+		wantErr bool
+	}{
+		{"ghcr.io/acme/web:1.0.1", false},
+		{"ghcr.io/acme/web:1.3.0", false},
+		{"ghcr.io/acme/web:2.0.0", true},
+		{"ghcr.io/acme/web:latest", true},
+		{"ghcr.io/evil/web:1.0.1", true},
+		{"docker.io/acme/web:1.0.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if err := checkUpdatePolicy(&svc, tt.image); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	unrestricted := testService("api", nil)
+	if err := checkUpdatePolicy(&unrestricted, "ghcr.io/other/api:9.0.0"); err != nil {
+		t.Errorf("service without a policy: got error %v", err)
+	}
+}
+
+func TestUpdatePolicyAppliesToV2(t *testing.T) {
+	s, fake := newTestServer(t, testService("web", map[string]string{autoUpdatePolicyLabel: "patch"}))
+
+	for _, image := range []string{"ghcr.io/acme/web:1.1.0", "ghcr.io/evil/web:1.0.1"} {
+		rec := doRequest(s, http.MethodPost, "/v2/services/web/update", `{"image": "`+image+`"}`)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%s: got status %d, want %d: %s", image, rec.Code, http.StatusConflict, rec.Body)
+		}
+	}
+	if changes := fake.Changes(); len(changes) > 0 {
+		t.Errorf("service was changed against its update policy: %v", changes)
+	}
+}
@@ -1,29 +1,68 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/docker/docker/api/types/swarm"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/errdefs"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/alexraskin/swarmctl/internal/audit"
+	"github.com/alexraskin/swarmctl/internal/docker"
 	"github.com/alexraskin/swarmctl/internal/metrics"
 	"github.com/alexraskin/swarmctl/internal/middle"
 )
 
+const (
+	defaultWaitTimeout  = 5 * time.Minute
+	maxWaitTimeout      = 30 * time.Minute
+	maxRequestBodySize  = 1 << 20
+	defaultLogTail      = "100"
+	defaultAuditLimit   = 100
+	defaultHistoryLimit = 50
+)
+
+// logRequests logs requests like middleware.Logger, but leaves out the query of webhook
+// requests, where Docker Hub sends its secret.
+func logRequests(next http.Handler) http.Handler {
+	logged := middleware.Logger(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/hooks/") || r.URL.RawQuery == "" {
+			logged.ServeHTTP(w, r)
+			return
+		}
+
+		// Log a copy without the query and hand the original on to the hook
+		redacted := r.Clone(r.Context())
+		redacted.URL.RawQuery = ""
+		redacted.RequestURI = redacted.URL.RequestURI()
+		middleware.Logger(http.HandlerFunc(func(w http.ResponseWriter, lr *http.Request) {
+			next.ServeHTTP(w, r.WithContext(lr.Context()))
+		})).ServeHTTP(w, redacted)
+	})
+}
+
 func (s *Server) Routes() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(logRequests)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/ping"))
-	r.Use(middle.AuthMiddleware(s.config.AuthToken))
 	r.Use(metrics.MetricsMiddleware)
 
 	r.Use(httprate.Limit(
@@ -37,12 +76,53 @@ func (s *Server) Routes() http.Handler {
 		),
 	))
 
-	r.Get("/version", s.serverVersion)
-	r.Get("/metrics", s.metricsHandler)
+	auditMiddleware := audit.Middleware(s.auditLog, func(err error) {
+		s.logger.Error("Failed to write audit entry", "error", err)
+	})
+
+	// Registry webhooks can't send a bearer token, so each hook verifies its own secret
+	r.Group(func(r chi.Router) {
+		r.Use(auditMiddleware)
+		r.Post("/v1/hooks/dockerhub", s.dockerHubHook)
+		r.Post("/v1/hooks/github-packages", s.githubPackagesHook)
+		r.Post("/v1/hooks/registry", s.registryHook)
+	})
 
 	r.Group(func(r chi.Router) {
+		r.Use(auditMiddleware)
+		r.Use(middle.AuthMiddleware(s.authenticators...))
+		r.Use(audit.Identify)
+
+		r.With(middle.RequireScope(middle.ScopeRead)).Get("/version", s.serverVersion)
+		r.With(middle.RequireScope(middle.ScopeMetrics)).Get("/metrics", s.metricsHandler)
+
 		r.Route("/v1", func(r chi.Router) {
-			r.Post("/update/{serviceName}", s.updateService)
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequireScope(middle.ScopeUpdate))
+				r.Post("/update/{serviceName}", s.updateService)
+				r.Post("/rollback/{serviceName}", s.rollbackService)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequireScope(middle.ScopeRead))
+				r.Get("/events", s.streamEvents)
+				r.Get("/services", s.listServices)
+				r.Get("/services/{serviceName}", s.getService)
+				r.Get("/services/{serviceName}/tasks", s.listServiceTasks)
+				r.Get("/services/{serviceName}/logs", s.streamServiceLogs)
+				r.Get("/services/{serviceName}/history", s.serviceHistory)
+				r.Get("/queue", s.listQueue)
+				r.Get("/deployments", s.listDeployments)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequireScope(middle.ScopeApprove))
+				r.Post("/deployments/{id}/approve", s.approveDeployment)
+				r.Post("/deployments/{id}/reject", s.rejectDeployment)
+			})
+			r.With(middle.RequireScope(middle.ScopeAdmin)).Get("/audit", s.queryAudit)
+		})
+		r.Route("/v2", func(r chi.Router) {
+			r.Use(middle.RequireScope(middle.ScopeUpdate))
+			r.Post("/services/{serviceName}/update", s.updateServiceV2)
 		})
 	})
 
@@ -81,6 +161,57 @@ func (s *Server) updateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	svc := s.authorizeServiceUpdate(w, r, serviceName)
+	if svc == nil {
+		return
+	}
+	auditService(r, svc)
+
+	wait, err := parseBoolQuery(r, "wait")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	force, err := parseBoolQuery(r, "force")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultWaitTimeout
+	if timeoutStr := r.URL.Query().Get("timeout"); timeoutStr != "" {
+		parsed, err := time.ParseDuration(timeoutStr)
+		if err != nil || parsed <= 0 || parsed > maxWaitTimeout {
+			http.Error(w, fmt.Sprintf("Invalid timeout, must be a duration up to %s", maxWaitTimeout), http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+
+	if err := checkUpdatePolicy(svc, image); err != nil {
+		if !force {
+			s.logger.Warn("Update rejected by policy", "error", err, "serviceName", serviceName, "image", image, "requestID", middleware.GetReqID(r.Context()))
+			http.Error(w, err.Error()+", pass force=true to override", http.StatusConflict)
+			return
+		}
+		s.logger.Warn("Update policy overridden with force", "error", err, "serviceName", serviceName, "image", image, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	}
+
+	held, err := s.gateDeployment(r.Context(), svc, image, middle.TokenName(r.Context()), middleware.GetReqID(r.Context()))
+	if err != nil {
+		s.logger.Error("Error holding back deployment", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if held != nil {
+		if entry := audit.FromContext(r.Context()); entry != nil {
+			entry.NewImage = held.Image
+		}
+		writeJSON(w, http.StatusAccepted, held)
+		return
+	}
+
 	start := time.Now()
 	response, err := s.dockerClient.UpdateDockerService(serviceName, image, r.Context())
 	duration := time.Since(start).Seconds()
@@ -92,8 +223,438 @@ func (s *Server) updateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if entry := audit.FromContext(r.Context()); entry != nil {
+		entry.NewImage = response.Image
+	}
+	s.recordDeployment(serviceName, "update", middle.TokenName(r.Context()), middleware.GetReqID(r.Context()), response)
+
+	status := http.StatusOK
+	if wait {
+		waitCtx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		rollout, err := s.dockerClient.WaitForServiceConvergence(serviceName, start, waitCtx)
+		if err != nil {
+			metrics.RecordDockerServiceUpdate(serviceName, "error", time.Since(start).Seconds())
+			s.logger.Error("Error waiting for service to converge", "error", err, "serviceName", serviceName, "image", image, "requestID", middleware.GetReqID(r.Context()))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.Rollout = rollout
+		if rollout.State != string(swarm.UpdateStateCompleted) {
+			response.Success = false
+			status = http.StatusInternalServerError
+			if rollout.State == docker.RolloutStateTimeout {
+				status = http.StatusGatewayTimeout
+			}
+			metrics.RecordDockerServiceUpdate(serviceName, "error", time.Since(start).Seconds())
+			s.logger.Error("Service update did not converge", "serviceName", serviceName, "image", image, "state", rollout.State, "message", rollout.Message, "requestID", middleware.GetReqID(r.Context()))
+			writeJSON(w, status, response)
+			return
+		}
+		duration = time.Since(start).Seconds()
+	}
+
 	metrics.RecordDockerServiceUpdate(serviceName, "success", duration)
-	s.logger.Info("Service updated", "serviceName", serviceName, "image", image, "requestID", middleware.GetReqID(r.Context()))
+	s.logger.Info("Service updated", "serviceName", serviceName, "image", image, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	writeJSON(w, status, response)
+}
+
+// auditService records the service a mutating request acts on and its current image.
+func auditService(r *http.Request, svc *swarm.Service) {
+	entry := audit.FromContext(r.Context())
+	if entry == nil {
+		return
+	}
+	entry.Service = svc.Spec.Name
+	if svc.Spec.TaskTemplate.ContainerSpec != nil {
+		entry.OldImage = svc.Spec.TaskTemplate.ContainerSpec.Image
+	}
+}
+
+// parseSince accepts a duration before now, such as "24h", or an RFC3339 timestamp.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value, must be a duration or RFC3339 timestamp")
+	}
+	return t, nil
+}
+
+// parseBoolQuery reads an optional boolean query parameter, defaulting to false.
+func parseBoolQuery(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value", key)
+	}
+	return parsed, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) rollbackService(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+
+	if serviceName == "" {
+		s.logger.Error("Request missing serviceName", "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, "Missing serviceName in path", http.StatusBadRequest)
+		return
+	}
+
+	svc := s.authorizeServiceUpdate(w, r, serviceName)
+	if svc == nil {
+		return
+	}
+	auditService(r, svc)
+
+	if s.refuseUnapproved(w, r, svc) || s.refuseOutsideWindow(w, r, svc) {
+		return
+	}
+
+	start := time.Now()
+	response, err := s.dockerClient.RollbackDockerService(serviceName, r.Context())
+	duration := time.Since(start).Seconds()
+
+	if err != nil {
+		metrics.RecordDockerServiceUpdate(serviceName, "rollback_error", duration)
+		s.logger.Error("Error rolling back service", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if entry := audit.FromContext(r.Context()); entry != nil {
+		entry.NewImage = response.Image
+	}
+
+	s.recordDeployment(serviceName, "rollback", middle.TokenName(r.Context()), middleware.GetReqID(r.Context()), response)
+
+	metrics.RecordDockerServiceUpdate(serviceName, "rollback_success", duration)
+	s.logger.Info("Service rolled back", "serviceName", serviceName, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+func (s *Server) updateServiceV2(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+
+	var update docker.ServiceUpdateSpec
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		s.logger.Error("Invalid update request body", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if serviceName == "" || update.IsEmpty() {
+		s.logger.Error("Request missing serviceName or changes", "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, "Missing serviceName in path or changes in body", http.StatusBadRequest)
+		return
+	}
+
+	svc := s.authorizeServiceUpdate(w, r, serviceName)
+	if svc == nil {
+		return
+	}
+	auditService(r, svc)
+
+	if s.refuseUnapproved(w, r, svc) || s.refuseOutsideWindow(w, r, svc) {
+		return
+	}
+
+	if update.Image != "" {
+		if err := checkUpdatePolicy(svc, update.Image); err != nil {
+			s.logger.Warn("Update rejected by policy", "error", err, "serviceName", serviceName, "image", update.Image, "requestID", middleware.GetReqID(r.Context()))
+			http.Error(w, err.Error()+", use /v1/update with force=true to override", http.StatusConflict)
+			return
+		}
+	}
+
+	start := time.Now()
+	response, err := s.dockerClient.ApplyDockerServiceUpdate(serviceName, update, r.Context())
+	duration := time.Since(start).Seconds()
+
+	var invalid *docker.ValidationError
+	if errors.As(err, &invalid) {
+		s.logger.Warn("Invalid service update", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		metrics.RecordDockerServiceUpdate(serviceName, "error", duration)
+		s.logger.Error("Error updating service", "error", err, "serviceName", serviceName, "image", update.Image, "force", update.Force, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if entry := audit.FromContext(r.Context()); entry != nil {
+		entry.NewImage = response.Image
+	}
+
+	s.recordDeployment(serviceName, "update", middle.TokenName(r.Context()), middleware.GetReqID(r.Context()), response)
+
+	metrics.RecordDockerServiceUpdate(serviceName, "success", duration)
+	s.logger.Info("Service updated", "serviceName", serviceName, "image", update.Image, "force", update.Force, "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) listServices(w http.ResponseWriter, r *http.Request) {
+	services, err := s.dockerClient.GetDockerServices(r.Context())
+	if err != nil {
+		s.logger.Error("Error listing services", "error", err, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]serviceSummary, 0, len(services))
+	for _, svc := range services {
+		summaries = append(summaries, s.newServiceSummary(svc))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *Server) getService(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+
+	svc, err := s.dockerClient.GetDockerServiceWithStatus(serviceName, r.Context())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			http.Error(w, "Service not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Error getting service", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.newServiceSummary(*svc))
+}
+
+func (s *Server) listServiceTasks(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+
+	svc, err := s.dockerClient.GetDockerService(serviceName, r.Context())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			http.Error(w, "Service not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Error getting service", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tasks, err := s.dockerClient.GetDockerTasks(svc.ID, r.Context())
+	if err != nil {
+		s.logger.Error("Error listing tasks", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Node names are a nicety, so don't fail the request without them
+	nodeNames, err := s.dockerClient.GetDockerNodeNames(r.Context())
+	if err != nil {
+		s.logger.Warn("Error listing nodes", "error", err, "requestID", middleware.GetReqID(r.Context()))
+	}
+
+	summaries := make([]taskSummary, 0, len(tasks))
+	for _, task := range tasks {
+		summaries = append(summaries, newTaskSummary(task, nodeNames))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Slot != summaries[j].Slot {
+			return summaries[i].Slot < summaries[j].Slot
+		}
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *Server) streamServiceLogs(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+	query := r.URL.Query()
+
+	opts := docker.ServiceLogsOptions{
+		Since: query.Get("since"),
+		Tail:  defaultLogTail,
+	}
+
+	var err error
+	if opts.Follow, err = parseBoolQuery(r, "follow"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Timestamps, err = parseBoolQuery(r, "timestamps"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if tail := query.Get("tail"); tail != "" {
+		if n, err := strconv.Atoi(tail); tail != "all" && (err != nil || n < 0) {
+			http.Error(w, "Invalid tail value, must be a number or \"all\"", http.StatusBadRequest)
+			return
+		}
+		opts.Tail = tail
+	}
+
+	if _, err := timetypes.GetTimestamp(opts.Since, time.Now()); opts.Since != "" && err != nil {
+		http.Error(w, "Invalid since value, must be a duration, unix timestamp or RFC3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	// Open the stream before writing anything, so Docker errors still get a status code
+	logs, err := s.dockerClient.OpenDockerServiceLogs(serviceName, opts, r.Context())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			http.Error(w, "Service not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Error opening service logs", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer logs.Close()
+
+	var stdout, stderr *lineWriter
+	if query.Get("format") == "sse" || r.Header.Get("Accept") == "text/event-stream" {
+		sse := newSSEWriter(w)
+		stdout = &lineWriter{emit: func(line string) error { return sse.Send("stdout", line) }}
+		stderr = &lineWriter{emit: func(line string) error { return sse.Send("stderr", line) }}
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		var mu sync.Mutex
+		rc := http.NewResponseController(w)
+		writeLine := func(prefix string) func(string) error {
+			return func(line string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if _, err := fmt.Fprintf(w, "%s%s\n", prefix, line); err != nil {
+					return err
+				}
+				return rc.Flush()
+			}
+		}
+		stdout = &lineWriter{emit: writeLine("")}
+		stderr = &lineWriter{emit: writeLine("[stderr] ")}
+	}
+
+	err = logs.Copy(stdout, stderr)
+	stdout.Close()
+	stderr.Close()
+
+	// Headers are already sent, so all we can do is log the failure
+	if err != nil {
+		s.logger.Error("Error streaming service logs", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+	}
+}
+
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	stack := r.URL.Query().Get("stack")
+
+	events, unsubscribe := s.eventHub.Subscribe()
+	defer unsubscribe()
+
+	sse := newSSEWriter(w)
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-keepAlive.C:
+			if err := sse.Comment("keep-alive"); err != nil {
+				return
+			}
+		case event := <-events:
+			if (service != "" && event.Service != service) || (stack != "" && event.Stack != stack) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.logger.Error("Error encoding event", "error", err)
+				continue
+			}
+			if err := sse.Send(event.Type+"."+event.Action, string(data)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) queryAudit(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.auditLog.Query(audit.Filter{
+		Service: r.URL.Query().Get("service"),
+		Since:   since,
+		Limit:   limit,
+	})
+	if err != nil {
+		s.logger.Error("Error querying audit log", "error", err, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) serviceHistory(w http.ResponseWriter, r *http.Request) {
+	serviceName := chi.URLParam(r, "serviceName")
+
+	limit := defaultHistoryLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deployments, err := s.history.List(serviceName, limit)
+	if err != nil {
+		s.logger.Error("Error reading deployment history", "error", err, "serviceName", serviceName, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deployments)
+}
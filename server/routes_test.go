@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/audit"
+)
+
+func TestUpdateServiceV2InvalidSpec(t *testing.T) {
+	global := testService("agent", nil)
+	global.Spec.Mode = swarm.ServiceMode{Global: &swarm.GlobalService{}}
+	s, fake := newTestServer(t, testService("web", nil), global)
+
+	tests := []struct {
+		name, service, body string
+	}{
+		{"bad memory", "web", `{"limits": {"memory": "lots"}}`},
+		{"negative cpus", "web", `{"limits": {"cpus": -1}}`},
+		{"replicas on global service", "agent", `{"replicas": 3}`},
+		{"remove update policy", "web", `{"labelRemove": ["swarmctl.autoupdate.policy"]}`},
+		{"add allowed tokens", "web", `{"labelAdd": {"swarmctl.allow-tokens": "ci"}}`},
+		{"add tunnel hostname", "web", `{"labelAdd": {"team": "web", "cloudflared.tunnel.0.hostname": "admin.example.com"}}`},
+		{"change tunnel target", "web", `{"labelAdd": {"cloudflared.tunnel.target": "10.0.0.1:22"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(s, http.MethodPost, "/v2/services/"+tt.service+"/update", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+		})
+	}
+
+	if changes := fake.Changes(); len(changes) > 0 {
+		t.Errorf("invalid updates reached Docker: %v", changes)
+	}
+}
+
+func TestAuditRecordsAuthFailures(t *testing.T) {
+	s, _ := newTestServer(t, testService("web", nil))
+
+	if rec := doRequestAs(s, "wrong-token", http.MethodPost, "/v1/rollback/web", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := doRequestAs(s, approverToken, http.MethodPost, "/v1/rollback/web", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	entries, err := s.auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %+v", len(entries), entries)
+	}
+	// Newest first
+	if e := entries[0]; e.Status != http.StatusForbidden || e.Outcome != "denied" || e.Token != "approver" {
+		t.Errorf("got entry %+v, want a denied 403 for the approver token", e)
+	}
+	if e := entries[1]; e.Status != http.StatusUnauthorized || e.Outcome != "denied" || e.Token != "" {
+		t.Errorf("got entry %+v, want an anonymous denied 401", e)
+	}
+}
+
+func TestStreamServiceLogsErrors(t *testing.T) {
+	s, _ := newTestServer(t, testService("web", nil))
+
+	tests := []struct {
+		name, path string
+		want       int
+	}{
+		{"invalid since", "/v1/services/web/logs?since=yesterday", http.StatusBadRequest},
+		{"invalid since with sse", "/v1/services/web/logs?since=yesterday&format=sse", http.StatusBadRequest},
+		{"unknown service", "/v1/services/api/logs", http.StatusNotFound},
+		{"docker error", "/v1/services/web/logs", http.StatusInternalServerError},
+		{"docker error with sse", "/v1/services/web/logs?format=sse", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(s, http.MethodGet, tt.path, "")
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequestLogRedactsHookSecret(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := middleware.DefaultLogger
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true})
+	t.Cleanup(func() { middleware.DefaultLogger = defaultLogger })
+
+	s, _ := newTestServer(t)
+	s.config.DockerHubWebhookSecret = "hook-secret"
+
+	// A 400 rather than a 401 shows the hook itself still saw the secret
+	rec := doRequestAs(s, "", http.MethodPost, "/v1/hooks/dockerhub?token=hook-secret", "not json")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	doRequest(s, http.MethodGet, "/v1/services?label=team", "")
+
+	logged := buf.String()
+	if strings.Contains(logged, "hook-secret") {
+		t.Errorf("request log contains the webhook secret: %s", logged)
+	}
+	if !strings.Contains(logged, "/v1/hooks/dockerhub ") {
+		t.Errorf("request log is missing the webhook request: %s", logged)
+	}
+	if !strings.Contains(logged, "/v1/services?label=team") {
+		t.Errorf("request log is missing the query of other requests: %s", logged)
+	}
+}
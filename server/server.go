@@ -3,15 +3,21 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/alexraskin/swarmctl/internal/audit"
 	"github.com/alexraskin/swarmctl/internal/cloudflare"
 	"github.com/alexraskin/swarmctl/internal/docker"
+	"github.com/alexraskin/swarmctl/internal/history"
+	"github.com/alexraskin/swarmctl/internal/middle"
 	"github.com/alexraskin/swarmctl/internal/pushover"
+	"github.com/alexraskin/swarmctl/internal/queue"
+	"github.com/alexraskin/swarmctl/internal/registry"
 	"github.com/alexraskin/swarmctl/internal/ver"
 )
 
@@ -22,6 +28,8 @@ type pendingRemoval struct {
 
 type Server struct {
 	ctx              context.Context
+	cancel           context.CancelFunc // stops the background loops, called by Shutdown
+	workers          sync.WaitGroup     // background loops that deploy and write to the stores
 	version          ver.Version
 	config           *Config
 	port             string
@@ -35,6 +43,18 @@ type Server struct {
 	cacheMu          sync.RWMutex
 	pendingRemovals  sync.Map // map[string]pendingRemoval
 	serviceHostnames sync.Map // map[serviceName][]string - cache of tunnel-enabled services
+	serviceEvents    sync.Map // map[serviceName]swarmEvent - last create/update, used to enrich removals
+	eventHub         *eventHub
+	authenticators   []middle.Authenticator
+	auditLog         *audit.Log
+	history          *history.Store
+	historyMu        sync.Mutex
+	historyWrites    sync.WaitGroup // recordDeployment goroutines still looking up labels
+	historyDraining  bool           // set by Shutdown, after which deployments are recorded inline
+	registryClient   *registry.Client
+	deployQueue      *queue.Store
+	approvals        *queue.Store
+	rejected         sync.Map // map[rejectedDeployment]time.Time - digests approvers turned down
 }
 
 func NewServer(
@@ -47,10 +67,18 @@ func NewServer(
 	logger *slog.Logger,
 	cfClient cloudflare.API,
 	cfSyncer *cloudflare.Syncer,
+	authenticators []middle.Authenticator,
+	auditLog *audit.Log,
+	history *history.Store,
+	registryClient *registry.Client,
+	deployQueue *queue.Store,
+	approvals *queue.Store,
 ) *Server {
 
+	ctx, cancel := context.WithCancel(ctx)
 	s := &Server{
 		ctx:            ctx,
+		cancel:         cancel,
 		version:        version,
 		config:         config,
 		port:           port,
@@ -60,6 +88,13 @@ func NewServer(
 		recentEvents:   sync.Map{},
 		cfClient:       cfClient,
 		cfSyncer:       cfSyncer,
+		eventHub:       newEventHub(),
+		authenticators: authenticators,
+		auditLog:       auditLog,
+		history:        history,
+		registryClient: registryClient,
+		deployQueue:    deployQueue,
+		approvals:      approvals,
 	}
 
 	s.server = &http.Server{
@@ -75,6 +110,15 @@ func (s *Server) Start() {
 	go s.startDockerMonitor()
 	go s.startEventCleanup(5*time.Minute, 10*time.Minute)
 	go s.startRemovalProcessor()
+	s.workers.Add(2)
+	go func() {
+		defer s.workers.Done()
+		s.startAutoUpdater()
+	}()
+	go func() {
+		defer s.workers.Done()
+		s.startQueueProcessor()
+	}()
 
 	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Error("Error while listening", slog.Any("err", err))
@@ -88,6 +132,30 @@ func (s *Server) Close() {
 	}
 }
 
+// Shutdown stops accepting requests and waits for in-flight ones, then stops the
+// background loops and waits for them and for deployments that are still being recorded,
+// so the stores can be closed safely afterwards.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	err := s.server.Shutdown(ctx)
+	s.cancel()
+	if err != nil {
+		return err
+	}
+
+	s.historyMu.Lock()
+	s.historyDraining = true
+	s.historyMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		s.historyWrites.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("deployments still running or being recorded: %w", ctx.Err())
+	}
 }
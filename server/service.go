@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"strings"
+	"slices"
 	"time"
 
+	"github.com/alexraskin/swarmctl/internal/cloudflare"
 	"github.com/alexraskin/swarmctl/internal/metrics"
 	"github.com/alexraskin/swarmctl/internal/pushover"
 	"github.com/docker/docker/api/types/filters"
@@ -19,34 +20,14 @@ const (
 	maxAge   = 1 * time.Hour
 )
 
-// extractHostnames extracts all hostnames from service labels
+// extractHostnames extracts all hostnames from service labels, grouped the same way the
+// Cloudflare syncer groups them
 func (s *Server) extractHostnames(labels map[string]string) []string {
-	hostnames := []string{}
-
-	// Add primary hostname if present
-	if primary := labels["cloudflared.tunnel.hostname"]; primary != "" {
-		for h := range strings.SplitSeq(primary, ",") {
-			if h = strings.TrimSpace(h); h != "" {
-				hostnames = append(hostnames, h)
-			}
-		}
-	}
-
-	// Add any additional hostnames from labels ending with .hostname
-	for k, v := range labels {
-		if k != "cloudflared.tunnel.hostname" && strings.HasSuffix(k, ".hostname") && v != "" {
-			for h := range strings.SplitSeq(v, ",") {
-				if h = strings.TrimSpace(h); h != "" {
-					hostnames = append(hostnames, h)
-				}
-			}
-		}
-	}
-
-	return hostnames
+	return cloudflare.Hostnames(labels)
 }
 
 func (s *Server) startDockerMonitor() error {
+	s.loadServiceEvents()
 	go s.monitorServiceEvents()
 	go s.monitorServiceRemovals()
 	go func() {
@@ -58,6 +39,28 @@ func (s *Server) startDockerMonitor() error {
 	return nil
 }
 
+// loadServiceEvents fills the serviceEvents cache from the running services, so removals
+// of services that were created before swarmctl started are enriched too.
+func (s *Server) loadServiceEvents() {
+	services, err := s.dockerClient.GetDockerServices(s.ctx)
+	if err != nil {
+		s.logger.Warn("Failed to list services for event enrichment", "error", err)
+		return
+	}
+
+	for _, svc := range services {
+		event := swarmEvent{
+			Service: svc.Spec.Name,
+			Stack:   svc.Spec.Labels[stackNamespaceKey],
+		}
+		if svc.Spec.TaskTemplate.ContainerSpec != nil {
+			event.Image = svc.Spec.TaskTemplate.ContainerSpec.Image
+		}
+		s.serviceEvents.Store(svc.Spec.Name, event)
+	}
+	s.logger.Debug("Loaded services for event enrichment", slog.Int("count", len(services)))
+}
+
 func (s *Server) monitorServiceEvents() error {
 	eventFilter := filters.NewArgs()
 	eventFilter.Add("type", "service")
@@ -91,11 +94,27 @@ func (s *Server) monitorServiceEvents() error {
 				name := msg.Actor.Attributes["name"]
 				metrics.RecordDockerEvent(string(msg.Action), name)
 
+				event := swarmEvent{
+					Type:    string(msg.Type),
+					Action:  string(msg.Action),
+					Service: name,
+					Time:    time.Unix(msg.Time, 0),
+				}
+
 				svc, err := s.dockerClient.GetDockerService(name, s.ctx)
 				if err != nil {
+					s.eventHub.Publish(event)
 					s.logger.Error("Fetch service failed", slog.String("service", name), "error", err)
 					continue
 				}
+
+				event.Stack = svc.Spec.Labels[stackNamespaceKey]
+				if svc.Spec.TaskTemplate.ContainerSpec != nil {
+					event.Image = svc.Spec.TaskTemplate.ContainerSpec.Image
+				}
+				s.serviceEvents.Store(name, event)
+				s.eventHub.Publish(event)
+
 				if svc.Spec.Labels["cloudflared.tunnel.enabled"] != "true" {
 					s.logger.Debug("Service is not enabled for Cloudflare tunnel", slog.String("service", name))
 					continue
@@ -151,6 +170,17 @@ func (s *Server) dockerEventsMonitor() error {
 				name := msg.Actor.Attributes["name"]
 				exitCode := msg.Actor.Attributes["exitCode"]
 
+				s.eventHub.Publish(swarmEvent{
+					Type:      string(msg.Type),
+					Action:    string(status),
+					Service:   msg.Actor.Attributes["com.docker.swarm.service.name"],
+					Stack:     msg.Actor.Attributes[stackNamespaceKey],
+					Image:     msg.Actor.Attributes["image"],
+					Container: containerID,
+					ExitCode:  exitCode,
+					Time:      time.Unix(msg.Time, 0),
+				})
+
 				eventKey := fmt.Sprintf("%s:%s", containerID, status)
 				now := time.Now()
 
@@ -163,20 +193,7 @@ func (s *Server) dockerEventsMonitor() error {
 
 				s.recentEvents.Store(eventKey, now)
 
-				pushoverMsg := pushover.PushoverMessage{
-					Title:     "DOCKER SWARM EVENT",
-					Message:   fmt.Sprintf("Container has died or restarted: %s (%s) with exit code %s", name, containerID, exitCode),
-					Timestamp: time.Unix(msg.Time, 0).Unix(),
-					Recipient: s.config.PushoverRecipient,
-				}
-
-				err := s.pushoverClient.SendNotification(pushoverMsg)
-				if err != nil {
-					metrics.RecordPushoverNotification("error")
-					s.logger.Error("Error sending Pushover notification", "error", err)
-				} else {
-					metrics.RecordPushoverNotification("success")
-				}
+				s.notify("DOCKER SWARM EVENT", fmt.Sprintf("Container has died or restarted: %s (%s) with exit code %s", name, containerID, exitCode), time.Unix(msg.Time, 0))
 
 				s.logger.Debug("Container event", "name", name, "containerID", containerID, "status", status, "exitCode", exitCode, "timestamp", time.Unix(msg.Time, 0).Format(time.RFC3339))
 			case <-s.ctx.Done():
@@ -187,6 +204,22 @@ func (s *Server) dockerEventsMonitor() error {
 	}
 }
 
+// notify sends a Pushover notification to the configured recipient.
+func (s *Server) notify(title, message string, at time.Time) {
+	err := s.pushoverClient.SendNotification(pushover.PushoverMessage{
+		Title:     title,
+		Message:   message,
+		Timestamp: at.Unix(),
+		Recipient: s.config.PushoverRecipient,
+	})
+	if err != nil {
+		metrics.RecordPushoverNotification("error")
+		s.logger.Error("Error sending Pushover notification", "error", err)
+	} else {
+		metrics.RecordPushoverNotification("success")
+	}
+}
+
 func (s *Server) startEventCleanup(interval time.Duration, maxAge time.Duration) {
 	ticker := time.NewTicker(interval)
 
@@ -247,6 +280,16 @@ func (s *Server) monitorServiceRemovals() error {
 				name := msg.Actor.Attributes["name"]
 				metrics.RecordDockerEvent(string(msg.Action), name)
 
+				// The service is gone, so enrich the event from its last create/update
+				event := swarmEvent{Service: name}
+				if last, ok := s.serviceEvents.LoadAndDelete(name); ok {
+					event = last.(swarmEvent)
+				}
+				event.Type = string(msg.Type)
+				event.Action = string(msg.Action)
+				event.Time = time.Unix(msg.Time, 0)
+				s.eventHub.Publish(event)
+
 				// Check if this service had cloudflare tunnel enabled by looking in our cache
 				_, exists := s.serviceHostnames.Load(name)
 				if !exists {
@@ -319,16 +362,25 @@ func (s *Server) reconcileTunnelConfig() error {
 		return fmt.Errorf("failed to list services: %w", err)
 	}
 
-	// Build a set of hostnames that SHOULD exist (from running services)
-	desiredHostnames := make(map[string]string) // hostname -> serviceName
+	// Build a set of rules that SHOULD exist (from running services), keyed on hostname and path
+	desiredRules := make(map[cloudflare.IngressKey]string) // rule -> serviceName
+	keptHostnames := make(map[string]bool)                 // hostnames of services with invalid labels
 	for _, svc := range services {
 		if svc.Spec.Labels["cloudflared.tunnel.enabled"] != "true" {
 			continue
 		}
 
-		hostnames := s.extractHostnames(svc.Spec.Labels)
-		for _, hostname := range hostnames {
-			desiredHostnames[hostname] = svc.Spec.Name
+		// Use the same rules the syncer writes, so both agree on what belongs to a service
+		rules, err := cloudflare.ServiceIngress(&svc)
+		if err != nil {
+			s.logger.Warn("Invalid tunnel labels, keeping its hostnames", slog.String("service", svc.Spec.Name), "error", err)
+			for _, hostname := range s.extractHostnames(svc.Spec.Labels) {
+				keptHostnames[hostname] = true
+			}
+			continue
+		}
+		for _, rule := range rules {
+			desiredRules[rule.Key()] = svc.Spec.Name
 		}
 	}
 
@@ -338,32 +390,42 @@ func (s *Server) reconcileTunnelConfig() error {
 		return fmt.Errorf("failed to load tunnel config: %w", err)
 	}
 
-	// 3. Find hostnames in tunnel config that shouldn't be there
-	orphanedHostnames := []string{}
-	for hostname := range tunnelConfig {
-		if hostname == "" {
+	// 3. Find rules in tunnel config that shouldn't be there
+	orphanedRules := []cloudflare.IngressKey{}
+	remainingHostnames := make(map[string]bool)
+	for key := range tunnelConfig {
+		if key.Hostname == "" {
 			continue
 		}
-		if _, exists := desiredHostnames[hostname]; !exists {
-			orphanedHostnames = append(orphanedHostnames, hostname)
+		if _, exists := desiredRules[key]; exists || keptHostnames[key.Hostname] {
+			remainingHostnames[key.Hostname] = true
+			continue
 		}
+		orphanedRules = append(orphanedRules, key)
 	}
 
-	if len(orphanedHostnames) == 0 {
+	if len(orphanedRules) == 0 {
 		s.logger.Debug("No orphaned tunnel configs found")
 		return nil
 	}
 
-	// 4. Remove orphaned hostnames
-	for _, hostname := range orphanedHostnames {
-		s.logger.Debug("Removing orphaned tunnel config", slog.String("hostname", hostname))
+	// 4. Remove orphaned rules in a single update, through the syncer so its cache agrees
+	for _, key := range orphanedRules {
+		s.logger.Debug("Removing orphaned tunnel config", slog.String("hostname", key.Hostname), slog.String("path", key.Path))
+	}
+	if err := s.cfSyncer.RemoveRules(s.ctx, orphanedRules); err != nil {
+		return fmt.Errorf("failed to remove orphaned tunnel configs: %w", err)
+	}
 
-		// Remove from tunnel config by updating with empty serviceURL
-		if err := s.cfClient.UpdateTunnelConfig(s.ctx, hostname, ""); err != nil {
-			s.logger.Error("Failed to remove tunnel config", "error", err, slog.String("hostname", hostname))
-			continue
+	// DNS records go with the last rule of a hostname
+	orphanedHostnames := []string{}
+	for _, key := range orphanedRules {
+		if !remainingHostnames[key.Hostname] && !slices.Contains(orphanedHostnames, key.Hostname) {
+			orphanedHostnames = append(orphanedHostnames, key.Hostname)
 		}
+	}
 
+	for _, hostname := range orphanedHostnames {
 		// Optionally delete DNS record
 		if s.config.DeleteDNSOnRemoval {
 			zoneID, err := s.cfClient.GetZoneID(s.ctx, hostname)
@@ -388,6 +450,6 @@ func (s *Server) reconcileTunnelConfig() error {
 		s.logger.Debug("Successfully removed orphaned tunnel config", slog.String("hostname", hostname))
 	}
 
-	s.logger.Debug("Tunnel config reconciliation complete", slog.Int("removed", len(orphanedHostnames)))
+	s.logger.Debug("Tunnel config reconciliation complete", slog.Int("removed", len(orphanedRules)))
 	return nil
 }
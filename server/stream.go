@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sseWriter writes Server-Sent Events and flushes after each one.
+type sseWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sse := &sseWriter{w: w, rc: http.NewResponseController(w)}
+	sse.rc.Flush()
+	return sse
+}
+
+func (s *sseWriter) Send(event, data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for line := range strings.SplitSeq(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	if _, err := fmt.Fprint(s.w, b.String()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Comment writes an SSE comment, which clients ignore, to keep idle connections open.
+func (s *sseWriter) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// lineWriter splits a byte stream into lines and hands each complete line to emit.
+type lineWriter struct {
+	buf  []byte
+	emit func(line string) error
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(lw.buf[:i]), "\r")
+		lw.buf = lw.buf[i+1:]
+		if err := lw.emit(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close emits any trailing partial line.
+func (lw *lineWriter) Close() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	line := string(lw.buf)
+	lw.buf = nil
+	return lw.emit(line)
+}
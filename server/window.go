@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/alexraskin/swarmctl/internal/middle"
+	"github.com/alexraskin/swarmctl/internal/queue"
+	"github.com/alexraskin/swarmctl/internal/window"
+)
+
+const (
+	deployWindowLabel = "swarmctl.deploy.window"
+	queueTick         = 1 * time.Minute
+)
+
+// deployWindow returns the schedule from the service's swarmctl.deploy.window label, or
+// nil if it may be deployed at any time.
+func deployWindow(svc *swarm.Service) (*window.Schedule, error) {
+	raw := svc.Spec.Labels[deployWindowLabel]
+	if raw == "" {
+		return nil, nil
+	}
+	return window.Parse(raw)
+}
+
+// queueDeployment queues an update of svc to image until its deploy window opens.
+func (s *Server) queueDeployment(svc *swarm.Service, schedule *window.Schedule, image, triggeredBy, requestID string) (queue.Item, error) {
+	item, replaced, err := s.deployQueue.Add(queue.Item{
+		Service:     svc.Spec.Name,
+		Image:       image,
+		TriggeredBy: triggeredBy,
+		RequestID:   requestID,
+		NotBefore:   schedule.Next(time.Now()),
+		Reason:      "outside deploy window " + schedule.String(),
+	})
+	if err != nil {
+		return queue.Item{}, err
+	}
+
+	for _, old := range replaced {
+		s.logger.Info("Queued deployment superseded", "id", old.ID, "serviceName", old.Service, "image", old.Image, "requestID", requestID)
+	}
+	s.logger.Info("Deployment queued until deploy window", "id", item.ID, "serviceName", item.Service, "image", image, "notBefore", item.NotBefore, "triggeredBy", triggeredBy, "requestID", requestID)
+	return item, nil
+}
+
+// refuseOutsideWindow rejects a change that can't be queued, such as a rollback or a v2
+// spec update, while svc's deploy window is closed. It writes the response itself and
+// returns true if the change was refused.
+func (s *Server) refuseOutsideWindow(w http.ResponseWriter, r *http.Request, svc *swarm.Service) bool {
+	schedule, err := deployWindow(svc)
+	if err != nil {
+		s.logger.Error("Invalid deploy window", "error", err, "serviceName", svc.Spec.Name, "requestID", middleware.GetReqID(r.Context()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	now := time.Now()
+	if schedule == nil || schedule.Contains(now) {
+		return false
+	}
+	s.logger.Warn("Change refused outside deploy window", "serviceName", svc.Spec.Name, "window", schedule.String(), "token", middle.TokenName(r.Context()), "requestID", middleware.GetReqID(r.Context()))
+	http.Error(w, fmt.Sprintf("%s is outside its deploy window %s, next opening at %s", svc.Spec.Name, schedule, schedule.Next(now).Format(time.RFC3339)), http.StatusConflict)
+	return true
+}
+
+// startQueueProcessor applies queued deployments once their service's deploy window is
+// open. The window is read from the service again each time, so relabelling a service
+// takes effect for updates that are already queued.
+func (s *Server) startQueueProcessor() {
+	ticker := time.NewTicker(queueTick)
+	defer ticker.Stop()
+
+	s.logger.Debug("Starting deployment queue processor")
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, item := range s.deployQueue.List() {
+				s.processQueued(item)
+			}
+
+		case <-s.ctx.Done():
+			s.logger.Debug("Stopping deployment queue processor")
+			return
+		}
+	}
+}
+
+func (s *Server) processQueued(item queue.Item) {
+	svc, err := s.dockerClient.GetDockerService(item.Service, s.ctx)
+	if errdefs.IsNotFound(err) {
+		s.logger.Warn("Dropping queued deployment for removed service", "id", item.ID, "serviceName", item.Service)
+		if _, _, err := s.deployQueue.Remove(item.ID); err != nil {
+			s.logger.Error("Failed to remove queued deployment", "id", item.ID, "error", err)
+		}
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to look up service for queued deployment", "id", item.ID, "serviceName", item.Service, "error", err)
+		return
+	}
+
+	schedule, err := deployWindow(svc)
+	if err != nil {
+		s.logger.Error("Invalid deploy window, keeping deployment queued", "id", item.ID, "serviceName", item.Service, "error", err)
+		return
+	}
+	if schedule != nil && !schedule.Contains(time.Now()) {
+		return
+	}
+
+	// Removing the item claims it, so it is applied at most once
+	if _, ok, err := s.deployQueue.Remove(item.ID); err != nil || !ok {
+		if err != nil {
+			s.logger.Error("Failed to remove queued deployment", "id", item.ID, "error", err)
+		}
+		return
+	}
+
+	s.logger.Info("Applying queued deployment", "id", item.ID, "serviceName", item.Service, "image", item.Image)
+	s.deployImage(s.ctx, item.Service, item.Image, item.TriggeredBy, item.RequestID)
+}
+
+func (s *Server) listQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.deployQueue.List())
+}
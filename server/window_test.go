@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// closedWindow returns a deploy window that is not open today or tomorrow.
+func closedWindow() string {
+	day := time.Now().UTC().AddDate(0, 0, 3).Weekday().String()[:3]
+	return day + " 02:00-03:00 UTC"
+}
+
+func TestClosedWindowRefusesUngatedChanges(t *testing.T) {
+	s, fake := newTestServer(t, testService("web", map[string]string{deployWindowLabel: closedWindow()}))
+
+	for _, target := range []string{"/v2/services/web/update", "/v1/rollback/web"} {
+		rec := doRequest(s, http.MethodPost, target, `{"force": true}`)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%s: got status %d, want %d: %s", target, rec.Code, http.StatusConflict, rec.Body)
+		}
+	}
+
+	if changes := fake.Changes(); len(changes) > 0 {
+		t.Errorf("service was changed outside its deploy window: %v", changes)
+	}
+}
+
+func TestUpdateValidatesQueryBeforeQueueing(t *testing.T) {
+	s, _ := newTestServer(t, testService("web", map[string]string{deployWindowLabel: closedWindow()}))
+
+	rec := doRequest(s, http.MethodPost, "/v1/update/web?image=ghcr.io/acme/web:2.0.0&timeout=forever", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if queued := s.deployQueue.List(); len(queued) != 0 {
+		t.Errorf("invalid request was queued: %+v", queued)
+	}
+
+	rec = doRequest(s, http.MethodPost, "/v1/update/web?image=ghcr.io/acme/web:2.0.0&timeout=1m", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	if queued := s.deployQueue.List(); len(queued) != 1 {
+		t.Errorf("got %d queued deployments, want 1", len(queued))
+	}
+}